@@ -0,0 +1,170 @@
+package capture
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Record is one chunk of raw bytes received on a connection. A capture file
+// stores records as a "<unix nanos> <connection id> <size>" line followed by
+// size bytes of data and a newline.
+type Record struct {
+	Time         time.Time
+	ConnectionId uint64
+	Data         []byte
+}
+
+// FlushInterval bounds how much of a capture is lost when the server is killed.
+const FlushInterval = time.Second
+
+// Writer appends records to a capture file. It is safe for concurrent use
+// from several event loops. Records are buffered and flushed every
+// FlushInterval and on Close, so recording does not put disk writes on the
+// path of every request.
+type Writer struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	header []byte
+	// err is the first failed flush, records are reported as lost after it.
+	err  error
+	done chan struct{}
+}
+
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{file: file, writer: bufio.NewWriterSize(file, 1<<16), done: make(chan struct{})}
+
+	go w.flushEvery(FlushInterval)
+
+	return w, nil
+}
+
+func (w *Writer) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mutex.Lock()
+			w.flush()
+			w.mutex.Unlock()
+		}
+	}
+}
+
+// flush expects the mutex to be held.
+func (w *Writer) flush() error {
+	if err := w.writer.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+
+	return w.err
+}
+
+func (w *Writer) Record(connectionId uint64, data []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.header = strconv.AppendInt(w.header[:0], time.Now().UnixNano(), 10)
+	w.header = append(w.header, ' ')
+	w.header = strconv.AppendUint(w.header, connectionId, 10)
+	w.header = append(w.header, ' ')
+	w.header = strconv.AppendInt(w.header, int64(len(data)), 10)
+	w.header = append(w.header, '\n')
+
+	if w.err != nil {
+		return w.err
+	}
+
+	// A full buffer is written out by the bufio.Writer itself.
+	w.writer.Write(w.header)
+	w.writer.Write(data)
+
+	if err := w.writer.WriteByte('\n'); err != nil {
+		w.err = err
+	}
+
+	return w.err
+}
+
+func (w *Writer) Close() error {
+	close(w.done)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if err := w.flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+func Read(reader io.Reader) ([]Record, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	var records []Record
+
+	for {
+		line, err := bufferedReader.ReadString('\n')
+
+		if err == io.EOF && len(line) == 0 {
+			return records, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", len(records)+1, err)
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("record %d: bad header %q", len(records)+1, line)
+		}
+
+		timestamp, timeErr := strconv.ParseInt(fields[0], 10, 64)
+		connectionId, connectionErr := strconv.ParseUint(fields[1], 10, 64)
+		size, sizeErr := strconv.Atoi(fields[2])
+
+		if timeErr != nil || connectionErr != nil || sizeErr != nil || size < 0 {
+			return nil, fmt.Errorf("record %d: bad header %q", len(records)+1, line)
+		}
+
+		record := Record{Time: time.Unix(0, timestamp), ConnectionId: connectionId, Data: make([]byte, size+1)}
+
+		if _, err := io.ReadFull(bufferedReader, record.Data); err != nil {
+			return nil, fmt.Errorf("record %d: %v", len(records)+1, err)
+		}
+
+		record.Data = record.Data[:size]
+		records = append(records, record)
+	}
+}
+
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Read(file)
+}
@@ -0,0 +1,124 @@
+package capture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter_Read(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture")
+
+	writer, err := Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer.Record(1, []byte("GET /users/1 HTTP/1.1\r\n\r\n"))
+	writer.Record(2, []byte("POST /users/new HTTP/1.1\r\nContent-Length: 2\r\n\r\n{}\n"))
+	writer.Record(1, nil)
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 || records[0].ConnectionId != 1 || records[1].ConnectionId != 2 || len(records[2].Data) != 0 {
+		t.Fatalf("unexpected records %+v", records)
+	}
+
+	if string(records[1].Data) != "POST /users/new HTTP/1.1\r\nContent-Length: 2\r\n\r\n{}\n" {
+		t.Errorf("unexpected data %q", records[1].Data)
+	}
+
+	if records[0].Time.After(records[1].Time) {
+		t.Error("records are not ordered by time")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+	defer httpServer.Close()
+
+	startedAt := time.Now()
+
+	records := []Record{
+		{Time: startedAt, ConnectionId: 1, Data: []byte("GET /users/1 HTTP/1.1\r\nHost: x\r\n\r\n")},
+		{Time: startedAt.Add(time.Millisecond), ConnectionId: 2, Data: []byte("GET /missing HTTP/1.1\r\nHost: x\r\n\r\n")},
+		{Time: startedAt.Add(20 * time.Millisecond), ConnectionId: 1, Data: []byte("GET /users/2 HTTP/1.1\r\nHost: x\r\n\r\n")},
+	}
+
+	for _, isRealTime := range []bool{false, true} {
+		options := ReplayOptions{Addr: strings.TrimPrefix(httpServer.URL, "http://"), RealTime: isRealTime, Timeout: time.Second}
+
+		report := Replay(records, options)
+
+		if report.Connections != 2 || report.Records != 3 || report.Responses != 3 || report.Errors != 0 {
+			t.Fatalf("realtime %v: unexpected report %+v", isRealTime, report)
+		}
+
+		if report.StatusCodes[200] != 2 || report.StatusCodes[404] != 1 {
+			t.Errorf("realtime %v: unexpected status codes %v", isRealTime, report.StatusCodes)
+		}
+
+		if isRealTime && report.Elapsed < 20*time.Millisecond {
+			t.Errorf("realtime replay took %s, expected the original 20ms at least", report.Elapsed)
+		}
+	}
+}
+
+func TestReplay_SplitAndPipelinedRecords(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer httpServer.Close()
+
+	startedAt := time.Now()
+
+	// The first request is cut in two records, the last record holds two.
+	records := []Record{
+		{Time: startedAt, ConnectionId: 1, Data: []byte("POST /users/1 HTTP/1.1\r\nHost: x\r\nContent-Len")},
+		{Time: startedAt, ConnectionId: 1, Data: []byte("gth: 2\r\n\r\n{}")},
+		{Time: startedAt, ConnectionId: 1, Data: []byte("GET /users/1 HTTP/1.1\r\nHost: x\r\n\r\nGET /users/2 HTTP/1.1\nHost: x\n\n")},
+	}
+
+	options := ReplayOptions{Addr: strings.TrimPrefix(httpServer.URL, "http://"), Timeout: time.Second}
+
+	report := Replay(records, options)
+
+	if report.Records != 3 || report.Responses != 3 || report.StatusCodes[200] != 3 || report.Errors != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if report.Elapsed >= options.Timeout {
+		t.Errorf("replay took %s, it waited for a response to a partial request", report.Elapsed)
+	}
+}
+
+func TestSplitRequests(t *testing.T) {
+	data := []byte("GET /users/1 HTTP/1.1\n\nPOST /users/new HTTP/1.1\r\nContent-Length: 2\r\n\r\n{}GET /users/2 HTTP/1.1\r\nHo")
+
+	if count, rest := splitRequests(data); count != 2 || string(rest) != "GET /users/2 HTTP/1.1\r\nHo" {
+		t.Errorf("unexpected split %d %q", count, rest)
+	}
+
+	if count, rest := splitRequests([]byte("POST /users/new HTTP/1.1\r\nContent-Length: 2\r\n\r\n{")); count != 0 || len(rest) == 0 {
+		t.Errorf("partial body counted as a request: %d %q", count, rest)
+	}
+}
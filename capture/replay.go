@@ -0,0 +1,262 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type ReplayOptions struct {
+	Addr string
+	// RealTime keeps the original gaps between records, scaled by Speed.
+	// Otherwise every connection sends its next record as soon as the
+	// responses to the requests completed by the previous one arrive, or
+	// after Timeout if they do not.
+	RealTime bool
+	Speed    float64
+	// Timeout is how long to wait for outstanding responses after the last record.
+	Timeout time.Duration
+}
+
+type ReplayReport struct {
+	Connections int
+	Records     int
+	Responses   int
+	Errors      int
+	StatusCodes map[int]int
+	Elapsed     time.Duration
+}
+
+// Replay opens one connection per captured connection id and sends its
+// records in order, so keep-alive and pipelining behave like the original traffic.
+func Replay(records []Record, options ReplayOptions) *ReplayReport {
+	report := &ReplayReport{StatusCodes: make(map[int]int)}
+
+	if len(records) == 0 {
+		return report
+	}
+
+	if options.Speed <= 0 {
+		options.Speed = 1
+	}
+
+	if options.Timeout == 0 {
+		options.Timeout = 2 * time.Second
+	}
+
+	connections := make(map[uint64][]Record)
+	var connectionIds []uint64
+
+	for _, record := range records {
+		if _, isExist := connections[record.ConnectionId]; !isExist {
+			connectionIds = append(connectionIds, record.ConnectionId)
+		}
+
+		connections[record.ConnectionId] = append(connections[record.ConnectionId], record)
+	}
+
+	report.Connections = len(connectionIds)
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+
+	firstRecordAt := records[0].Time
+	startedAt := time.Now()
+
+	for _, connectionId := range connectionIds {
+		waitGroup.Add(1)
+
+		go func(connectionRecords []Record) {
+			defer waitGroup.Done()
+
+			result := replayConnection(connectionRecords, options, firstRecordAt, startedAt)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			report.Records += result.Records
+			report.Responses += result.Responses
+			report.Errors += result.Errors
+
+			for statusCode, count := range result.StatusCodes {
+				report.StatusCodes[statusCode] += count
+			}
+		}(connections[connectionId])
+	}
+
+	waitGroup.Wait()
+
+	report.Elapsed = time.Since(startedAt)
+
+	return report
+}
+
+func replayConnection(records []Record, options ReplayOptions, firstRecordAt time.Time, startedAt time.Time) *ReplayReport {
+	result := &ReplayReport{StatusCodes: make(map[int]int)}
+
+	if options.RealTime {
+		time.Sleep(time.Until(scheduledAt(records[0], options, firstRecordAt, startedAt)))
+	}
+
+	conn, err := net.DialTimeout("tcp", options.Addr, options.Timeout)
+
+	if err != nil {
+		result.Errors++
+		return result
+	}
+
+	defer conn.Close()
+
+	readDone := make(chan struct{})
+	responses := make(chan struct{}, len(records))
+	readErrors := 0
+	var pending []byte
+
+	go func() {
+		defer close(readDone)
+
+		reader := bufio.NewReader(conn)
+
+		for {
+			// Peek first, ReadResponse reports a clean close as io.ErrUnexpectedEOF.
+			_, err := reader.Peek(1)
+
+			if err != nil {
+				if netErr, isNetErr := err.(net.Error); err != io.EOF && (!isNetErr || !netErr.Timeout()) {
+					readErrors++
+				}
+
+				return
+			}
+
+			response, err := http.ReadResponse(reader, nil)
+
+			if err != nil {
+				readErrors++
+				return
+			}
+
+			io.Copy(ioutil.Discard, response.Body)
+			response.Body.Close()
+
+			result.Responses++
+			result.StatusCodes[response.StatusCode]++
+
+			// Nobody waits in real time and pipelined records answer more
+			// than once, a full channel has no one left to tell.
+			select {
+			case responses <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	for _, record := range records {
+		if options.RealTime {
+			time.Sleep(time.Until(scheduledAt(record, options, firstRecordAt, startedAt)))
+		}
+
+		if _, err := conn.Write(record.Data); err != nil {
+			result.Errors++
+			break
+		}
+
+		result.Records++
+
+		if options.RealTime {
+			continue
+		}
+
+		// A record holds any part of the stream, a request may span records
+		// and a pipelined record holds several.
+		var countRequests int
+
+		pending = append(pending, record.Data...)
+		countRequests, pending = splitRequests(pending)
+
+		if !waitResponses(responses, readDone, countRequests, options.Timeout) {
+			pending = pending[:0]
+		}
+	}
+
+	// Half-closing lets the server answer the outstanding requests and close
+	// the connection, the deadline covers servers that wait for more input.
+	if tcpConn, isTCP := conn.(*net.TCPConn); isTCP {
+		tcpConn.CloseWrite()
+	}
+
+	conn.SetReadDeadline(time.Now().Add(options.Timeout))
+	<-readDone
+
+	result.Errors += readErrors
+
+	return result
+}
+
+// waitResponses waits for count responses and tells whether they all came
+// before the timeout and the end of the connection.
+func waitResponses(responses <-chan struct{}, readDone <-chan struct{}, count int, timeout time.Duration) bool {
+	if count == 0 {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for ; count > 0; count-- {
+		select {
+		case <-responses:
+		case <-readDone:
+			return false
+		case <-timer.C:
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitRequests counts the complete requests at the start of data and returns
+// the incomplete rest. A malformed request counts as one, the server answers
+// it with an error, and leaves no rest.
+func splitRequests(data []byte) (count int, rest []byte) {
+	for len(data) > 0 {
+		// ReadRequest takes a cut line for a whole one, so wait for the blank
+		// line ending the headers, with "\n" or "\r\n" line endings.
+		if !bytes.Contains(data, []byte("\n\n")) && !bytes.Contains(data, []byte("\n\r\n")) {
+			return count, data
+		}
+
+		reader := bytes.NewReader(data)
+		bufferedReader := bufio.NewReader(reader)
+		request, err := http.ReadRequest(bufferedReader)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return count, data
+		}
+
+		if err != nil {
+			return count + 1, data[:0]
+		}
+
+		_, err = io.Copy(ioutil.Discard, request.Body)
+
+		if err == io.ErrUnexpectedEOF {
+			return count, data
+		}
+
+		count++
+		data = data[len(data)-reader.Len()-bufferedReader.Buffered():]
+	}
+
+	return count, data
+}
+
+func scheduledAt(record Record, options ReplayOptions, firstRecordAt time.Time, startedAt time.Time) time.Time {
+	return startedAt.Add(time.Duration(float64(record.Time.Sub(firstRecordAt)) / options.Speed))
+}
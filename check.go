@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"github.com/ArtyomNorin/hlc2017_go/checker"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"github.com/ArtyomNorin/hlc2017_go/server"
+	"log"
+	"os"
+)
+
+func runCheck(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	ammoPath := flags.String("ammo", "", "phantom ammo file with requests")
+	answersPath := flags.String("answers", "", "answers file with expected responses")
+	addr := flags.String("addr", "", "address of a running server, the server runs in-process when empty")
+	dataPath := flags.String("data", "/tmp/hlc/data", "dataset for the in-process server")
+	optionsPath := flags.String("options", "/tmp/data/options.txt", "options.txt for the in-process server")
+	maxDiffs := flags.Int("max-diffs", 20, "count of mismatches to print")
+	flags.Parse(args)
+
+	ammoFile, err := os.Open(*ammoPath)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ammo, err := checker.ReadAmmo(ammoFile)
+	ammoFile.Close()
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	answersFile, err := os.Open(*answersPath)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	answers, err := checker.ReadAnswers(answersFile)
+	answersFile.Close()
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var target checker.Target
+
+	if *addr != "" {
+		tcpTarget := &checker.TCPTarget{Addr: *addr}
+		defer tcpTarget.Close()
+
+		target = tcpTarget
+	} else {
+		database, err := loader.Load(*dataPath, *optionsPath)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		database.SortIndexes()
+
+		target = &checker.ServerTarget{Server: server.NewServer(database)}
+	}
+
+	report, err := checker.Check(target, ammo, answers)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	report.Print(os.Stdout, *maxDiffs)
+
+	if len(report.Mismatches) != 0 {
+		os.Exit(1)
+	}
+}
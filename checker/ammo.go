@@ -0,0 +1,139 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Ammo is one request of a phantom ammo file: a "<size> <tag>" line followed
+// by size bytes of raw HTTP request.
+type Ammo struct {
+	Tag     string
+	Request []byte
+}
+
+// Answer is one line of a competition answers file:
+// METHOD \t URI \t STATUS \t BODY.
+type Answer struct {
+	Method     string
+	Uri        string
+	StatusCode int
+	Body       []byte
+}
+
+func ReadAmmo(reader io.Reader) ([]Ammo, error) {
+	bufferedReader := bufio.NewReader(reader)
+
+	var ammo []Ammo
+
+	for {
+		line, err := bufferedReader.ReadString('\n')
+
+		if err == io.EOF && len(strings.TrimSpace(line)) == 0 {
+			return ammo, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		line = strings.TrimSpace(line)
+
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+
+		size, err := strconv.Atoi(fields[0])
+
+		if err != nil {
+			return nil, fmt.Errorf("ammo %d: bad size line %q", len(ammo)+1, line)
+		}
+
+		item := Ammo{Request: make([]byte, size)}
+
+		if len(fields) == 2 {
+			item.Tag = fields[1]
+		}
+
+		if _, err := io.ReadFull(bufferedReader, item.Request); err != nil {
+			return nil, fmt.Errorf("ammo %d: %v", len(ammo)+1, err)
+		}
+
+		ammo = append(ammo, item)
+	}
+}
+
+func ReadAnswers(reader io.Reader) ([]Answer, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var answers []Answer
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if len(line) == 0 {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\t", 4)
+
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("answer %d: expected at least 3 tab separated fields", len(answers)+1)
+		}
+
+		statusCode, err := strconv.Atoi(fields[2])
+
+		if err != nil {
+			return nil, fmt.Errorf("answer %d: bad status %q", len(answers)+1, fields[2])
+		}
+
+		answer := Answer{Method: fields[0], Uri: fields[1], StatusCode: statusCode}
+
+		if len(fields) == 4 {
+			answer.Body = []byte(fields[3])
+		}
+
+		answers = append(answers, answer)
+	}
+
+	return answers, scanner.Err()
+}
+
+// Route returns the method and path of a raw request with numeric path
+// segments replaced by <id>, so that mismatches can be grouped.
+func Route(request []byte) string {
+	lineEndIndex := bytes.IndexByte(request, '\n')
+
+	if lineEndIndex == -1 {
+		lineEndIndex = len(request)
+	}
+
+	fields := strings.Fields(string(request[:lineEndIndex]))
+
+	if len(fields) < 2 {
+		return "malformed"
+	}
+
+	path := fields[1]
+
+	if queryIndex := strings.IndexByte(path, '?'); queryIndex != -1 {
+		path = path[:queryIndex]
+	}
+
+	segments := strings.Split(path, "/")
+
+	for index, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil {
+			segments[index] = "<id>"
+		}
+	}
+
+	return fields[0] + " " + strings.Join(segments, "/")
+}
@@ -0,0 +1,251 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/server"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Target executes one raw HTTP request and returns the status and body of the response.
+type Target interface {
+	Do(request []byte) (statusCode int, body []byte, err error)
+}
+
+// ServerTarget runs requests against an in-process Server without sockets.
+type ServerTarget struct {
+	Server *server.Server
+	out    []byte
+}
+
+func (t *ServerTarget) Do(request []byte) (int, []byte, error) {
+	t.out, _ = t.Server.ServeRaw(request, t.out[:0])
+
+	statusCode, body, _, err := readResponse(bufio.NewReader(bytes.NewReader(t.out)))
+
+	return statusCode, body, err
+}
+
+// TCPTarget sends requests over one keep-alive connection to a running
+// server. A request is never sent twice, since a POST may have been applied
+// before the connection broke. Do returns the error instead and the next
+// request opens a new connection, as it does after a response which closes it.
+type TCPTarget struct {
+	Addr    string
+	Timeout time.Duration
+	conn    net.Conn
+	reader  *bufio.Reader
+}
+
+func (t *TCPTarget) Do(request []byte) (int, []byte, error) {
+	if t.conn == nil {
+		conn, err := net.DialTimeout("tcp", t.Addr, t.timeout())
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		t.conn = conn
+		t.reader = bufio.NewReader(conn)
+	}
+
+	t.conn.SetDeadline(time.Now().Add(t.timeout()))
+
+	if _, err := t.conn.Write(request); err != nil {
+		t.Close()
+		return 0, nil, err
+	}
+
+	statusCode, body, isClose, err := readResponse(t.reader)
+
+	if err != nil || isClose {
+		t.Close()
+	}
+
+	return statusCode, body, err
+}
+
+func (t *TCPTarget) timeout() time.Duration {
+	if t.Timeout == 0 {
+		return 2 * time.Second
+	}
+
+	return t.Timeout
+}
+
+func (t *TCPTarget) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+
+	err := t.conn.Close()
+	t.conn = nil
+	t.reader = nil
+
+	return err
+}
+
+// readResponse also tells whether the server closes the connection after the response.
+func readResponse(reader *bufio.Reader) (int, []byte, bool, error) {
+	response, err := http.ReadResponse(reader, nil)
+
+	if err != nil {
+		return 0, nil, false, err
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if err != nil {
+		return response.StatusCode, body, response.Close, err
+	}
+
+	body, err = decodeBody(response.Header.Get("Content-Encoding"), body)
+
+	return response.StatusCode, body, response.Close, err
+}
+
+// decodeBody undoes the compression a server negotiates when the ammo accepts it.
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+
+	switch encoding {
+	case "":
+		return body, nil
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unknown content encoding %q", encoding)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+type Mismatch struct {
+	Index   int
+	Route   string
+	Request []byte
+	Answer  Answer
+	Status  int
+	Body    []byte
+	Diffs   []string
+}
+
+type RouteStats struct {
+	Route      string
+	Total      int
+	Mismatches int
+}
+
+type Report struct {
+	Total      int
+	Mismatches []Mismatch
+	Routes     []RouteStats
+}
+
+// Check replays ammo against target and compares each response with the
+// answer at the same position.
+func Check(target Target, ammo []Ammo, answers []Answer) (*Report, error) {
+	if len(ammo) != len(answers) {
+		return nil, fmt.Errorf("%d requests in ammo but %d answers", len(ammo), len(answers))
+	}
+
+	report := new(Report)
+	routes := make(map[string]*RouteStats)
+
+	for index, item := range ammo {
+		route := Route(item.Request)
+
+		stats, isExist := routes[route]
+
+		if !isExist {
+			stats = &RouteStats{Route: route}
+			routes[route] = stats
+		}
+
+		stats.Total++
+		report.Total++
+
+		mismatch := Mismatch{Index: index + 1, Route: route, Request: item.Request, Answer: answers[index]}
+
+		statusCode, body, err := target.Do(item.Request)
+
+		switch {
+		case err != nil:
+			mismatch.Diffs = []string{"request failed: " + err.Error()}
+		case statusCode != answers[index].StatusCode:
+			mismatch.Diffs = []string{fmt.Sprintf("status: expected %d, got %d", answers[index].StatusCode, statusCode)}
+		case statusCode == 200 && len(answers[index].Body) != 0:
+			mismatch.Diffs, err = CompareJSON(answers[index].Body, body)
+
+			if err != nil {
+				return nil, fmt.Errorf("answer %d: %v", index+1, err)
+			}
+		}
+
+		if len(mismatch.Diffs) != 0 {
+			mismatch.Status = statusCode
+			mismatch.Body = body
+			stats.Mismatches++
+			report.Mismatches = append(report.Mismatches, mismatch)
+		}
+	}
+
+	for _, stats := range routes {
+		report.Routes = append(report.Routes, *stats)
+	}
+
+	sort.Slice(report.Routes, func(i, j int) bool {
+		return report.Routes[i].Route < report.Routes[j].Route
+	})
+
+	return report, nil
+}
+
+// Print writes per-route totals and at most maxDiffs mismatches.
+func (r *Report) Print(writer io.Writer, maxDiffs int) {
+	for index, mismatch := range r.Mismatches {
+		if index == maxDiffs {
+			fmt.Fprintf(writer, "... %d more mismatches\n\n", len(r.Mismatches)-maxDiffs)
+			break
+		}
+
+		requestLine := mismatch.Request
+
+		if lineEndIndex := bytes.IndexByte(requestLine, '\n'); lineEndIndex != -1 {
+			requestLine = bytes.TrimSpace(requestLine[:lineEndIndex])
+		}
+
+		fmt.Fprintf(writer, "#%d %s\n", mismatch.Index, requestLine)
+
+		for _, diff := range mismatch.Diffs {
+			fmt.Fprintf(writer, "    %s\n", diff)
+		}
+
+		fmt.Fprintf(writer, "    expected: %d %s\n", mismatch.Answer.StatusCode, mismatch.Answer.Body)
+		fmt.Fprintf(writer, "    actual:   %d %s\n\n", mismatch.Status, mismatch.Body)
+	}
+
+	for _, stats := range r.Routes {
+		fmt.Fprintf(writer, "%-30s %8d requests %8d mismatches\n", stats.Route, stats.Total, stats.Mismatches)
+	}
+
+	fmt.Fprintf(writer, "%-30s %8d requests %8d mismatches\n", "total", r.Total, len(r.Mismatches))
+}
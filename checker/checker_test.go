@@ -0,0 +1,178 @@
+package checker
+
+import (
+	"bufio"
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"github.com/ArtyomNorin/hlc2017_go/server"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAmmo(t *testing.T) {
+	first := "GET /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n"
+	second := "POST /users/new HTTP/1.1\r\nHost: travels.com\r\nContent-Length: 2\r\n\r\n{}"
+
+	input := strconv.Itoa(len(first)) + " GET:/users/<id>\n" + first + "\n" +
+		strconv.Itoa(len(second)) + " POST:/users/new\n" + second + "\n"
+
+	ammo, err := ReadAmmo(strings.NewReader(input))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ammo) != 2 || string(ammo[0].Request) != first || string(ammo[1].Request) != second || ammo[1].Tag != "POST:/users/new" {
+		t.Fatalf("unexpected ammo %q", ammo)
+	}
+}
+
+func TestReadAnswers(t *testing.T) {
+	answers, err := ReadAnswers(strings.NewReader("GET\t/locations/1/avg\t200\t{\"avg\": 3.5}\nGET\t/users/bad\t404\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(answers) != 2 || answers[0].StatusCode != 200 || string(answers[0].Body) != `{"avg": 3.5}` || answers[1].StatusCode != 404 || answers[1].Uri != "/users/bad" {
+		t.Fatalf("unexpected answers %+v", answers)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	route := Route([]byte("GET /users/752/visits?toDistance=49 HTTP/1.1\r\n"))
+
+	if route != "GET /users/<id>/visits" {
+		t.Errorf("unexpected route %q", route)
+	}
+}
+
+func TestCompareJSON(t *testing.T) {
+	diffs, err := CompareJSON([]byte(`{"avg": 3.33333, "b": [1, 2]}`), []byte(`{"b": [1, 2], "avg": 3.333330}`))
+
+	if err != nil || len(diffs) != 0 {
+		t.Errorf("expected equal json, got %v %v", diffs, err)
+	}
+
+	diffs, _ = CompareJSON([]byte(`{"visits": [{"mark": 3}, {"mark": 4}]}`), []byte(`{"visits": [{"mark": 3, "place": "x"}]}`))
+
+	expected := []string{"$.visits: expected 2 items, got 1", `$.visits[0].place: unexpected "x"`}
+
+	if strings.Join(diffs, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected diffs %q", diffs)
+	}
+
+	diffs, _ = CompareJSON([]byte(`{"avg": 3.3}`), []byte(`{"avg": 3.31}`))
+
+	if len(diffs) != 1 {
+		t.Errorf("expected avg mismatch, got %q", diffs)
+	}
+}
+
+func TestCheck_ServerTarget(t *testing.T) {
+	database, err := generator.GenerateAndLoad(t.TempDir(), generator.TrainOptions())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := database.GetUser(1)
+
+	// The first answer is compressed and has to be decoded before comparing.
+	ammo := []Ammo{
+		{Request: []byte("GET /users/1 HTTP/1.1\r\nHost: travels.com\r\nAccept-Encoding: gzip\r\n\r\n")},
+		{Request: []byte("GET /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n")},
+		{Request: []byte("GET /users/0 HTTP/1.1\r\nHost: travels.com\r\n\r\n")},
+	}
+
+	answers := []Answer{
+		{Method: "GET", Uri: "/users/1", StatusCode: 200, Body: user.Serialize(nil)},
+		{Method: "GET", Uri: "/users/1", StatusCode: 200, Body: []byte(`{"id": 1, "email": "wrong"}`)},
+		{Method: "GET", Uri: "/users/0", StatusCode: 404},
+	}
+
+	httpServer := server.NewServer(database)
+	httpServer.CompressMinSize = 1
+
+	report, err := Check(&ServerTarget{Server: httpServer}, ammo, answers)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 3 || len(report.Mismatches) != 1 || report.Mismatches[0].Index != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if len(report.Routes) != 1 || report.Routes[0].Route != "GET /users/<id>" || report.Routes[0].Mismatches != 1 {
+		t.Errorf("unexpected routes %+v", report.Routes)
+	}
+}
+
+// TestTCPTarget_NoResend checks that a request whose connection breaks is
+// reported once and not sent again, and that the next request reconnects.
+func TestTCPTarget_NoResend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	requests := make(chan string, 4)
+
+	go func() {
+		for number := 0; ; number++ {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			request, err := http.ReadRequest(bufio.NewReader(conn))
+
+			if err != nil {
+				conn.Close()
+				continue
+			}
+
+			requests <- request.URL.Path
+
+			// The first connection breaks before answering.
+			if number > 0 {
+				conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\n{}"))
+			}
+
+			conn.Close()
+		}
+	}()
+
+	target := &TCPTarget{Addr: listener.Addr().String(), Timeout: time.Second}
+	defer target.Close()
+
+	if _, _, err := target.Do([]byte("POST /users/new HTTP/1.1\r\nContent-Length: 2\r\n\r\n{}")); err == nil {
+		t.Fatal("broken connection was not reported")
+	}
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		if statusCode, body, err := target.Do([]byte("GET " + path + " HTTP/1.1\r\n\r\n")); err != nil || statusCode != 200 || string(body) != "{}" {
+			t.Fatalf("%s: unexpected response %d %q %v", path, statusCode, body, err)
+		}
+	}
+
+	close(requests)
+
+	var paths []string
+
+	for path := range requests {
+		paths = append(paths, path)
+	}
+
+	if strings.Join(paths, " ") != "/users/new /users/1 /users/2" {
+		t.Errorf("unexpected requests %q", paths)
+	}
+}
@@ -0,0 +1,108 @@
+package checker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// FloatTolerance is the allowed difference between numbers, "avg" answers
+// are rounded to 5 digits by the reference implementation.
+const FloatTolerance = 1e-5
+
+// CompareJSON returns a description of every difference between expected and
+// actual, ignoring key order and small float differences.
+func CompareJSON(expected []byte, actual []byte) ([]string, error) {
+	var expectedValue, actualValue interface{}
+
+	if err := json.Unmarshal(expected, &expectedValue); err != nil {
+		return nil, fmt.Errorf("expected body is not json: %v", err)
+	}
+
+	if err := json.Unmarshal(actual, &actualValue); err != nil {
+		return []string{fmt.Sprintf("$: body is not json: %q", actual)}, nil
+	}
+
+	return compareValues("$", expectedValue, actualValue, nil), nil
+}
+
+func compareValues(path string, expected interface{}, actual interface{}, diffs []string) []string {
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, isObject := actual.(map[string]interface{})
+
+		if !isObject {
+			return append(diffs, fmt.Sprintf("%s: expected object, got %s", path, describe(actual)))
+		}
+
+		keys := make([]string, 0, len(expectedValue)+len(actualValue))
+
+		for key := range expectedValue {
+			keys = append(keys, key)
+		}
+
+		for key := range actualValue {
+			if _, isExist := expectedValue[key]; !isExist {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			expectedField, isExpected := expectedValue[key]
+			actualField, isActual := actualValue[key]
+
+			switch {
+			case !isActual:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing, expected %s", path, key, describe(expectedField)))
+			case !isExpected:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected %s", path, key, describe(actualField)))
+			default:
+				diffs = compareValues(path+"."+key, expectedField, actualField, diffs)
+			}
+		}
+
+		return diffs
+
+	case []interface{}:
+		actualValue, isArray := actual.([]interface{})
+
+		if !isArray {
+			return append(diffs, fmt.Sprintf("%s: expected array, got %s", path, describe(actual)))
+		}
+
+		if len(expectedValue) != len(actualValue) {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %d items, got %d", path, len(expectedValue), len(actualValue)))
+		}
+
+		for index := 0; index < len(expectedValue) && index < len(actualValue); index++ {
+			diffs = compareValues(path+"["+strconv.Itoa(index)+"]", expectedValue[index], actualValue[index], diffs)
+		}
+
+		return diffs
+
+	case float64:
+		actualValue, isNumber := actual.(float64)
+
+		if !isNumber || math.Abs(expectedValue-actualValue) > FloatTolerance {
+			return append(diffs, fmt.Sprintf("%s: expected %s, got %s", path, describe(expected), describe(actual)))
+		}
+
+		return diffs
+	}
+
+	if expected != actual {
+		diffs = append(diffs, fmt.Sprintf("%s: expected %s, got %s", path, describe(expected), describe(actual)))
+	}
+
+	return diffs
+}
+
+func describe(value interface{}) string {
+	encoded, _ := json.Marshal(value)
+
+	return string(encoded)
+}
@@ -0,0 +1,280 @@
+package db
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrRolledBack = errors.New("operation rolled back")
+var ErrNotApplied = errors.New("operation not applied")
+
+// Operation is one create or update of a batch. Entity is UserEntity,
+// LocationEntity or VisitEntity and picks which of the fields is used.
+type Operation struct {
+	Entity   string
+	IsCreate bool
+	Id       int
+	User     *UserFields
+	Location *LocationFields
+	Visit    *VisitFields
+}
+
+// Apply runs the operations in order under one write lock and appends an
+// error per operation to errs, nil for those applied. With isAtomic the first
+// failure undoes the operations applied before it, they get ErrRolledBack and
+// the ones after it ErrNotApplied.
+func (db *DataBase) Apply(operations []Operation, isAtomic bool, errs []error) []error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	start := len(errs)
+	undos := make([]func(), 0, len(operations))
+
+	for index := range operations {
+		undo, err := db.apply(&operations[index])
+		errs = append(errs, err)
+
+		if err == nil {
+			undos = append(undos, undo)
+			continue
+		}
+
+		if !isAtomic {
+			continue
+		}
+
+		for undoIndex := len(undos) - 1; undoIndex >= 0; undoIndex-- {
+			undos[undoIndex]()
+		}
+
+		for errIndex := start; errIndex < len(errs)-1; errIndex++ {
+			errs[errIndex] = ErrRolledBack
+		}
+
+		for range operations[index+1:] {
+			errs = append(errs, ErrNotApplied)
+		}
+
+		break
+	}
+
+	return errs
+}
+
+// apply runs one operation and returns what reverts it. A create is reverted
+// by shrinking the slice back, an update by updating back to the previous
+// fields and then putting back every version the two updates bumped, so a
+// rolled back entity keeps its ETag.
+func (db *DataBase) apply(operation *Operation) (undo func(), err error) {
+	id := operation.Id
+
+	switch operation.Entity {
+	case UserEntity:
+		if operation.User == nil {
+			return nil, ErrInvalid
+		}
+
+		if operation.IsCreate {
+			length := len(db.Users)
+
+			return func() {
+				db.Users[id-1] = nil
+				db.Users = db.Users[:length]
+			}, db.createUser(id, operation.User)
+		}
+
+		user, isFound := db.GetUser(id)
+
+		if !isFound {
+			return nil, ErrNotFound
+		}
+
+		previous := user.fields()
+		versions := user.saveVersions(nil)
+
+		return func() { db.updateUser(id, previous, nil); versions.restore() }, db.updateUser(id, operation.User, nil)
+
+	case LocationEntity:
+		if operation.Location == nil {
+			return nil, ErrInvalid
+		}
+
+		if operation.IsCreate {
+			length := len(db.Locations)
+
+			return func() {
+				db.Locations[id-1] = nil
+				db.Locations = db.Locations[:length]
+			}, db.createLocation(id, operation.Location)
+		}
+
+		location, isFound := db.GetLocation(id)
+
+		if !isFound {
+			return nil, ErrNotFound
+		}
+
+		previous := location.fields()
+		versions := location.saveVersions(nil)
+
+		return func() { db.updateLocation(id, previous, nil); versions.restore() }, db.updateLocation(id, operation.Location, nil)
+
+	case VisitEntity:
+		if operation.Visit == nil {
+			return nil, ErrInvalid
+		}
+
+		fields := operation.Visit
+
+		if operation.IsCreate {
+			length := len(db.Visits)
+			versions := db.saveOwnerVersions(nil, fields)
+
+			return func() {
+				db.removeVisit(db.Visits[id-1], 0)
+				db.Visits = db.Visits[:length]
+				versions.restore()
+			}, db.createVisit(id, fields)
+		}
+
+		visit, isFound := db.GetVisit(id)
+
+		if !isFound {
+			return nil, ErrNotFound
+		}
+
+		previous := visit.fields()
+		versions := db.saveOwnerVersions(visit.saveVersions(nil), fields)
+
+		return func() { db.updateVisit(id, previous, nil); versions.restore() }, db.updateVisit(id, fields, nil)
+	}
+
+	return nil, ErrInvalid
+}
+
+// savedVersions holds versions an operation may bump, restore puts them back.
+type savedVersions []savedVersion
+
+type savedVersion struct {
+	version *uint64
+	value   uint64
+}
+
+func (s savedVersions) save(version *uint64) savedVersions {
+	return append(s, savedVersion{version, *version})
+}
+
+func (s savedVersions) restore() {
+	for _, saved := range s {
+		*saved.version = saved.value
+	}
+}
+
+// saveVersions saves the user and the locations it visited, which follow its gender and age.
+func (u *User) saveVersions(versions savedVersions) savedVersions {
+	versions = versions.save(&u.Version)
+
+	for _, visit := range u.VisitsIndex {
+		versions = versions.save(&visit.Location.Version)
+	}
+
+	return versions
+}
+
+// saveVersions saves the location and its visitors, which follow its place, country and distance.
+func (l *Location) saveVersions(versions savedVersions) savedVersions {
+	versions = versions.save(&l.Version)
+
+	for _, visit := range l.VisitsIndex {
+		versions = versions.save(&visit.User.Version)
+	}
+
+	return versions
+}
+
+func (v *Visit) saveVersions(versions savedVersions) savedVersions {
+	versions = versions.save(&v.Version)
+	versions = versions.save(&v.User.Version)
+
+	return versions.save(&v.Location.Version)
+}
+
+// saveOwnerVersions saves the user and the location a visit is moved to or created with.
+func (db *DataBase) saveOwnerVersions(versions savedVersions, fields *VisitFields) savedVersions {
+	if fields.User != nil {
+		if user, isFound := db.GetUser(*fields.User); isFound {
+			versions = versions.save(&user.Version)
+		}
+	}
+
+	if fields.Location != nil {
+		if location, isFound := db.GetLocation(*fields.Location); isFound {
+			versions = versions.save(&location.Version)
+		}
+	}
+
+	return versions
+}
+
+func (u *User) fields() *UserFields {
+	email, firstName, lastName, gender, birthDate := u.Email, u.FirstName, u.LastName, u.Gender, u.BirthDate
+
+	return &UserFields{Email: &email, FirstName: &firstName, LastName: &lastName, Gender: &gender, BirthDate: &birthDate}
+}
+
+func (l *Location) fields() *LocationFields {
+	place, country, city, distance := l.Place, l.Country, l.City, int(l.Distance)
+
+	return &LocationFields{Place: &place, Country: &country, City: &city, Distance: &distance}
+}
+
+func (v *Visit) fields() *VisitFields {
+	location, user, visitedAt, mark := int(v.Location.Id), int(v.User.Id), v.VisitedAt, int(v.Mark)
+
+	return &VisitFields{Location: &location, User: &user, VisitedAt: &visitedAt, Mark: &mark}
+}
+
+// Transaction applies the operations atomically. Creates go before updates
+// and users and locations before visits whatever their order, so an update
+// or a visit may reference an entity the transaction creates. On failure it
+// returns the index of the operation at fault and its error, nothing is
+// applied then.
+func (db *DataBase) Transaction(operations []Operation) (int, error) {
+	order := make([]int, len(operations))
+
+	for index := range order {
+		order[index] = index
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return transactionRank(&operations[order[i]]) < transactionRank(&operations[order[j]])
+	})
+
+	ordered := make([]Operation, len(operations))
+
+	for index, operationIndex := range order {
+		ordered[index] = operations[operationIndex]
+	}
+
+	for index, err := range db.Apply(ordered, true, nil) {
+		if err != nil && err != ErrRolledBack && err != ErrNotApplied {
+			return order[index], err
+		}
+	}
+
+	return -1, nil
+}
+
+// transactionRank is the group an operation is applied in by Transaction:
+// creates of users and locations, creates of visits, then updates.
+func transactionRank(operation *Operation) int {
+	if !operation.IsCreate {
+		return 2
+	}
+
+	if operation.Entity == VisitEntity {
+		return 1
+	}
+
+	return 0
+}
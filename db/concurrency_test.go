@@ -0,0 +1,154 @@
+package db_test
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// TestDataBase_ConcurrentMutations is meant for the race detector: writers
+// create, move and delete visits while readers check under RLock that no index is
+// seen half-updated.
+func TestDataBase_ConcurrentMutations(t *testing.T) {
+	const countWriters = 4
+	const countReaders = 2
+	const countMutations = 100
+
+	database := randomDataBase(t, rand.New(rand.NewSource(1)))
+
+	countUsers := len(database.Users)
+	countLocations := len(database.Locations)
+	countVisits := len(database.Visits)
+
+	var waitGroup sync.WaitGroup
+
+	done := make(chan struct{})
+	errs := make(chan string, countReaders)
+
+	for writer := 0; writer < countWriters; writer++ {
+		waitGroup.Add(1)
+
+		go func(writer int) {
+			defer waitGroup.Done()
+
+			random := rand.New(rand.NewSource(int64(writer)))
+
+			for i := 0; i < countMutations; i++ {
+				fields := &db.VisitFields{
+					User:      intPtr(1 + random.Intn(countUsers)),
+					Location:  intPtr(1 + random.Intn(countLocations)),
+					VisitedAt: intPtr(randomVisitedAt(random)),
+					Mark:      intPtr(random.Intn(6)),
+				}
+
+				switch random.Intn(4) {
+				case 0:
+					database.CreateVisit(countVisits+1+writer*countMutations+i, fields)
+				case 1:
+					database.UpdateVisit(1+random.Intn(countVisits), fields)
+				case 2:
+					database.DeleteVisit(1+random.Intn(countVisits), nil)
+				default:
+					database.UpdateUser(1+random.Intn(countUsers), &db.UserFields{BirthDate: intPtr(randomBirthDate(random))})
+				}
+			}
+		}(writer)
+	}
+
+	var readersGroup sync.WaitGroup
+
+	for reader := 0; reader < countReaders; reader++ {
+		readersGroup.Add(1)
+
+		go func() {
+			defer readersGroup.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				if message := checkIndexes(database); message != "" {
+					errs <- message
+					return
+				}
+			}
+		}()
+	}
+
+	waitGroup.Wait()
+
+	close(done)
+	readersGroup.Wait()
+	close(errs)
+
+	for message := range errs {
+		t.Error(message)
+	}
+
+	if message := checkIndexes(database); message != "" {
+		t.Error(message)
+	}
+}
+
+func checkIndexes(database *db.DataBase) string {
+	database.RLock()
+	defer database.RUnlock()
+
+	countIndexed := 0
+
+	for _, user := range database.Users {
+		if user == nil {
+			continue
+		}
+
+		for index, visit := range user.VisitsIndex {
+			if visit.User != user {
+				return "visit is in the index of another user"
+			}
+
+			if index > 0 && user.VisitsIndex[index-1].VisitedAt > visit.VisitedAt {
+				return "user visits are not ordered by visited_at"
+			}
+		}
+
+		countIndexed += len(user.VisitsIndex)
+	}
+
+	countVisits := 0
+
+	for _, visit := range database.Visits {
+		if visit != nil {
+			countVisits++
+		}
+	}
+
+	if countIndexed != countVisits {
+		return "user indexes do not hold every visit once"
+	}
+
+	countIndexed = 0
+
+	for _, location := range database.Locations {
+		if location == nil {
+			continue
+		}
+
+		for _, visit := range location.VisitsIndex {
+			if visit.Location != location {
+				return "visit is in the index of another location"
+			}
+		}
+
+		countIndexed += len(location.VisitsIndex)
+	}
+
+	if countIndexed != countVisits {
+		return "location indexes do not hold every visit once"
+	}
+
+	return ""
+}
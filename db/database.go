@@ -0,0 +1,237 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DataBase is shared by all event loops. Mutations take the write lock, so a
+// reader holding RLock never sees a half-applied update: entity fields, the
+// id slices and both visit indexes change together. Getters do not lock, the
+// caller holds RLock from the lookup until it has finished reading the
+// returned entities, serialization included.
+type DataBase struct {
+	Users              []*User
+	Locations          []*Location
+	Visits             []*Visit
+	TimeDataGeneration time.Time
+	IsTrain            bool
+	mutex              sync.RWMutex
+	lastVersion        uint64
+	tombstones         map[tombstoneKey]Tombstone
+}
+
+func NewDataBase(timeDataGeneration time.Time, isTrain bool) *DataBase {
+	database := new(DataBase)
+
+	database.TimeDataGeneration = timeDataGeneration
+	database.IsTrain = isTrain
+	// Versions start from the start time, so a version seen before a restart is never reused.
+	database.lastVersion = uint64(time.Now().UnixNano())
+	database.tombstones = make(map[tombstoneKey]Tombstone)
+
+	if database.IsTrain {
+		database.Users = make([]*User, 0, 10062)
+		database.Locations = make([]*Location, 0, 7978)
+		database.Visits = make([]*Visit, 0, 100620)
+	} else {
+		/*database.Users = make([]*User, 0, 1000074)
+		database.Locations = make([]*Location, 0, 761314)
+		database.Visits = make([]*Visit, 0, 10000740)*/
+
+		database.Users = make([]*User, 0, 1000058)
+		database.Locations = make([]*Location, 0, 763802)
+		database.Visits = make([]*Visit, 0, 10000580)
+	}
+
+	return database
+}
+
+func (db *DataBase) PrintStats() {
+	fmt.Println(fmt.Sprintf("Count users: %d", len(db.Users)))
+	fmt.Println(fmt.Sprintf("Count locations: %d", len(db.Locations)))
+	fmt.Println(fmt.Sprintf("Count visits: %d", len(db.Visits)))
+}
+
+func (db *DataBase) SortIndexes() {
+	for _, user := range db.Users {
+		if user == nil {
+			continue
+		}
+
+		sort.Slice(user.VisitsIndex, func(i, j int) bool {
+			return user.VisitsIndex[i].VisitedAt < user.VisitsIndex[j].VisitedAt
+		})
+	}
+}
+
+type VisitedPlacesFilter struct {
+	FromDate   int
+	ToDate     int
+	Country    string
+	ToDistance int
+}
+
+type AvgMarkFilter struct {
+	FromDate int
+	ToDate   int
+	Gender   string
+	FromAge  int
+	ToAge    int
+}
+
+type AvgMark struct {
+	Value       float64
+	CountVisits int
+}
+
+// nextVersion is called once per mutation under the write lock, every
+// entity the mutation touches gets the same version.
+func (db *DataBase) nextVersion() uint64 {
+	db.lastVersion++
+	return db.lastVersion
+}
+
+func (db *DataBase) RLock() {
+	db.mutex.RLock()
+}
+
+func (db *DataBase) RUnlock() {
+	db.mutex.RUnlock()
+}
+
+// IsUserExist, IsLocationExist and IsVisitExist take the read lock themselves.
+func (db *DataBase) IsUserExist(id int) bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	_, isFound := db.GetUser(id)
+
+	return isFound
+}
+
+func (db *DataBase) IsLocationExist(id int) bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	_, isFound := db.GetLocation(id)
+
+	return isFound
+}
+
+func (db *DataBase) IsVisitExist(id int) bool {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	_, isFound := db.GetVisit(id)
+
+	return isFound
+}
+
+func (db *DataBase) GetUser(id int) (*User, bool) {
+	if id < 1 || len(db.Users) < id || db.Users[id-1] == nil || db.Users[id-1].IsDeleted {
+		return nil, false
+	}
+
+	return db.Users[id-1], true
+}
+
+func (db *DataBase) GetLocation(id int) (*Location, bool) {
+	if id < 1 || len(db.Locations) < id || db.Locations[id-1] == nil || db.Locations[id-1].IsDeleted {
+		return nil, false
+	}
+
+	return db.Locations[id-1], true
+}
+
+func (db *DataBase) GetVisit(id int) (*Visit, bool) {
+	if id < 1 || len(db.Visits) < id || db.Visits[id-1] == nil || db.Visits[id-1].IsDeleted {
+		return nil, false
+	}
+
+	return db.Visits[id-1], true
+}
+
+func (db *DataBase) GetVisitedPlaces(id int, filter *VisitedPlacesFilter, visits []*Visit) ([]*Visit, bool) {
+	user, isFound := db.GetUser(id)
+
+	if !isFound {
+		return visits, false
+	}
+
+	for _, visit := range user.VisitsIndex {
+		if visit.IsDeleted {
+			continue
+		}
+
+		if filter.FromDate != 0 && visit.VisitedAt < filter.FromDate {
+			continue
+		}
+
+		if filter.ToDate != 0 && visit.VisitedAt > filter.ToDate {
+			continue
+		}
+
+		if filter.Country != "" && visit.Location.Country != filter.Country {
+			continue
+		}
+
+		if filter.ToDistance != 0 && visit.Location.Distance >= uint32(filter.ToDistance) {
+			continue
+		}
+
+		visits = append(visits, visit)
+	}
+
+	return visits, true
+}
+
+func (db *DataBase) GetAvgMark(id int, filter *AvgMarkFilter) (AvgMark, bool) {
+	var avgMark AvgMark
+
+	location, isFound := db.GetLocation(id)
+
+	if !isFound {
+		return avgMark, false
+	}
+
+	sumOfMarks := 0
+
+	for _, visit := range location.VisitsIndex {
+		if visit.IsDeleted {
+			continue
+		}
+
+		if filter.FromDate != 0 && visit.VisitedAt < filter.FromDate {
+			continue
+		}
+
+		if filter.ToDate != 0 && visit.VisitedAt > filter.ToDate {
+			continue
+		}
+
+		if filter.Gender != "" && visit.User.Gender != filter.Gender {
+			continue
+		}
+
+		if filter.FromAge != 0 && int(db.TimeDataGeneration.AddDate(-filter.FromAge, 0, 0).Unix()) < visit.User.BirthDate {
+			continue
+		}
+
+		if filter.ToAge != 0 && int(db.TimeDataGeneration.AddDate(-filter.ToAge, 0, 0).Unix()) > visit.User.BirthDate {
+			continue
+		}
+
+		sumOfMarks += int(visit.Mark)
+		avgMark.CountVisits++
+	}
+
+	if avgMark.CountVisits != 0 {
+		avgMark.Value = math.Round(float64(sumOfMarks)/float64(avgMark.CountVisits)*100000) / 100000
+	}
+
+	return avgMark, true
+}
@@ -0,0 +1,73 @@
+package db_test
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"testing"
+)
+
+func BenchmarkDataBase_GetVisitedPlaces(b *testing.B) {
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	visits := make([]*db.Visit, 0, 64)
+
+	filter := new(db.VisitedPlacesFilter)
+
+	filter.ToDistance = 49
+	filter.ToDate = 1397433600
+	filter.FromDate = 1189209600
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		visits, _ = database.GetVisitedPlaces(752, filter, visits[:0])
+	}
+}
+
+func BenchmarkDataBase_GetAvgMark(b *testing.B) {
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	filter := new(db.AvgMarkFilter)
+
+	filter.Gender = "m"
+	filter.FromAge = 4
+	filter.FromDate = 1453680000
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		database.GetAvgMark(752, filter)
+	}
+}
+
+func BenchmarkDataBase_GetUser(b *testing.B) {
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	entityBuffer := make([]byte, 0, 4096)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		user, _ := database.GetUser(752)
+		entityBuffer = user.Serialize(entityBuffer[:0])
+	}
+}
+func TestAppendJSONString(t *testing.T) {
+	quoted := string(db.AppendJSONString(nil, "a\"b\\c\n}é😀"))
+
+	if quoted != `"a\"b\\c\u000a\u007d\u00e9\ud83d\ude00"` {
+		t.Errorf("unexpected quoted string %s", quoted)
+	}
+}
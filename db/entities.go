@@ -0,0 +1,173 @@
+package db
+
+import (
+	"github.com/valyala/fasthttp"
+	"reflect"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Version grows with every mutation which changes what an entity or its
+// aggregate route returns, see DataBase.nextVersion. IsDeleted marks a soft
+// deleted entity, the getters hide it until it is restored or purged.
+type User struct {
+	Id          uint32
+	Email       string
+	FirstName   string
+	LastName    string
+	Gender      string
+	BirthDate   int
+	VisitsIndex []*Visit
+	Version     uint64
+	IsDeleted   bool
+}
+
+type Location struct {
+	Place       string
+	Country     string
+	City        string
+	Id          uint32
+	Distance    uint32
+	VisitsIndex []*Visit
+	Version     uint64
+	IsDeleted   bool
+}
+
+type Visit struct {
+	Id        uint32
+	Location  *Location
+	User      *User
+	VisitedAt int
+	Mark      int8
+	IsDeleted bool
+	Version   uint64
+}
+
+func (u *User) Serialize(entityBuffer []byte) []byte {
+	entityBuffer = append(entityBuffer, `{"first_name":"`...)
+	entityBuffer = appendEscaped(entityBuffer, u.FirstName)
+	entityBuffer = append(entityBuffer, `","last_name":"`...)
+	entityBuffer = appendEscaped(entityBuffer, u.LastName)
+	entityBuffer = append(entityBuffer, `","gender":"`...)
+	entityBuffer = appendEscaped(entityBuffer, u.Gender)
+	entityBuffer = append(entityBuffer, `","email":"`...)
+	entityBuffer = appendEscaped(entityBuffer, u.Email)
+	entityBuffer = append(entityBuffer, `","birth_date":`...)
+	entityBuffer = strconv.AppendInt(entityBuffer, int64(u.BirthDate), 10)
+	entityBuffer = append(entityBuffer, `,"id":`...)
+	entityBuffer = fasthttp.AppendUint(entityBuffer, int(u.Id))
+	entityBuffer = append(entityBuffer, '}')
+
+	return entityBuffer
+}
+
+func (l *Location) Serialize(entityBuffer []byte) []byte {
+	entityBuffer = append(entityBuffer, `{"distance":`...)
+	entityBuffer = strconv.AppendUint(entityBuffer, uint64(l.Distance), 10)
+	entityBuffer = append(entityBuffer, `,"city":"`...)
+	entityBuffer = appendEscaped(entityBuffer, l.City)
+	entityBuffer = append(entityBuffer, `","country":"`...)
+	entityBuffer = appendEscaped(entityBuffer, l.Country)
+	entityBuffer = append(entityBuffer, `","place":"`...)
+	entityBuffer = appendEscaped(entityBuffer, l.Place)
+	entityBuffer = append(entityBuffer, `","id":`...)
+	entityBuffer = fasthttp.AppendUint(entityBuffer, int(l.Id))
+	entityBuffer = append(entityBuffer, '}')
+
+	return entityBuffer
+}
+
+func (v *Visit) Serialize(entityBuffer []byte) []byte {
+	entityBuffer = append(entityBuffer, `{"mark":`...)
+	entityBuffer = strconv.AppendInt(entityBuffer, int64(v.Mark), 10)
+	entityBuffer = append(entityBuffer, `,"visited_at":`...)
+	entityBuffer = strconv.AppendInt(entityBuffer, int64(v.VisitedAt), 10)
+	entityBuffer = append(entityBuffer, `,"user":`...)
+	entityBuffer = fasthttp.AppendUint(entityBuffer, int(v.User.Id))
+	entityBuffer = append(entityBuffer, `,"id":`...)
+	entityBuffer = fasthttp.AppendUint(entityBuffer, int(v.Id))
+	entityBuffer = append(entityBuffer, `,"location":`...)
+	entityBuffer = fasthttp.AppendUint(entityBuffer, int(v.Location.Id))
+	entityBuffer = append(entityBuffer, '}')
+
+	return entityBuffer
+}
+
+func (v *Visit) SerializeVisited(entityBuffer []byte) []byte {
+	entityBuffer = append(entityBuffer, `{"mark":`...)
+	entityBuffer = strconv.AppendInt(entityBuffer, int64(v.Mark), 10)
+	entityBuffer = append(entityBuffer, `,"visited_at":`...)
+	entityBuffer = strconv.AppendInt(entityBuffer, int64(v.VisitedAt), 10)
+	entityBuffer = append(entityBuffer, `,"place":"`...)
+	entityBuffer = appendEscaped(entityBuffer, v.Location.Place)
+	entityBuffer = append(entityBuffer, `"}`...)
+
+	return entityBuffer
+}
+
+// AppendJSONString quotes value for JSON. Non-ASCII runes are escaped as
+// \uXXXX like the competition data does, and so is '}' since the loader
+// splits entities on it.
+func AppendJSONString(out []byte, value string) []byte {
+	out = append(out, '"')
+
+	for _, char := range value {
+		switch {
+		case char == '"' || char == '\\':
+			out = append(out, '\\', byte(char))
+		case char < 0x20 || char == '}' || char >= utf8.RuneSelf:
+			if char > 0xffff {
+				high, low := utf16.EncodeRune(char)
+				out = appendUnicodeEscape(appendUnicodeEscape(out, high), low)
+			} else {
+				out = appendUnicodeEscape(out, char)
+			}
+		default:
+			out = append(out, byte(char))
+		}
+	}
+
+	return append(out, '"')
+}
+
+func appendUnicodeEscape(out []byte, char rune) []byte {
+	return append(out, '\\', 'u', hexDigits[char>>12&0xf], hexDigits[char>>8&0xf], hexDigits[char>>4&0xf], hexDigits[char&0xf])
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendEscaped appends value inside a JSON string for the responses, which
+// only escape quotes, backslashes and control characters and keep UTF-8 as is.
+func appendEscaped(out []byte, value string) []byte {
+	for index := 0; index < len(value); index++ {
+		char := value[index]
+
+		switch {
+		case char == '"' || char == '\\':
+			out = append(out, '\\', char)
+		case char < 0x20:
+			out = append(out, `\u00`...)
+			out = append(out, hexDigits[char>>4], hexDigits[char&0xf])
+		default:
+			out = append(out, char)
+		}
+	}
+
+	return out
+}
+
+func stringToBytes(str string) []byte {
+	strh := (*reflect.StringHeader)(unsafe.Pointer(&str))
+	var b []byte
+	sh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+	sh.Data = strh.Data
+	sh.Len = strh.Len
+	sh.Cap = strh.Len
+	return b
+}
+
+func bytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
@@ -0,0 +1,539 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var ErrNotFound = errors.New("entity not found")
+var ErrAlreadyExists = errors.New("entity already exists")
+var ErrInvalid = errors.New("invalid entity fields")
+var ErrPreconditionFailed = errors.New("entity version does not match")
+var ErrHasVisits = errors.New("entity still has visits")
+
+// MaxIdGap bounds how far past the last id a create may go, entities are
+// stored in slices indexed by id and one request must not allocate gigabytes.
+const MaxIdGap = 1 << 20
+
+// Precondition is checked against the current version of an entity under the
+// write lock, so no other update can slip in between. Nil always holds.
+type Precondition func(version uint64) bool
+
+func (p Precondition) holds(version uint64) bool {
+	return p == nil || p(version)
+}
+
+// DeletePolicy decides what deleting a user or a location does to its visits.
+type DeletePolicy int
+
+const (
+	// RejectDelete keeps an entity which still has visits and returns ErrHasVisits.
+	RejectDelete DeletePolicy = iota
+	// CascadeDelete deletes the visits along with the entity.
+	CascadeDelete
+)
+
+func ParseDeletePolicy(name string) (DeletePolicy, error) {
+	switch name {
+	case "reject":
+		return RejectDelete, nil
+	case "cascade":
+		return CascadeDelete, nil
+	}
+
+	return RejectDelete, fmt.Errorf("unknown delete policy %q", name)
+}
+
+// UserFields, LocationFields and VisitFields describe the fields of a create
+// or an update. A nil field is left untouched by updates and is not allowed
+// in creates.
+type UserFields struct {
+	Email     *string
+	FirstName *string
+	LastName  *string
+	Gender    *string
+	BirthDate *int
+}
+
+type LocationFields struct {
+	Place    *string
+	Country  *string
+	City     *string
+	Distance *int
+}
+
+type VisitFields struct {
+	Location  *int
+	User      *int
+	VisitedAt *int
+	Mark      *int
+}
+
+func (f *UserFields) isComplete() bool {
+	return f.Email != nil && f.FirstName != nil && f.LastName != nil && f.Gender != nil && f.BirthDate != nil
+}
+
+// Timestamps are seconds since the epoch in 32 bits like the competition
+// data, visits cannot happen before the epoch but births can.
+func (f *UserFields) isValid() bool {
+	if f.BirthDate != nil && (*f.BirthDate < math.MinInt32 || *f.BirthDate > math.MaxInt32) {
+		return false
+	}
+
+	return f.Gender == nil || *f.Gender == "m" || *f.Gender == "f"
+}
+
+func (f *LocationFields) isComplete() bool {
+	return f.Place != nil && f.Country != nil && f.City != nil && f.Distance != nil
+}
+
+func (f *LocationFields) isValid() bool {
+	return f.Distance == nil || (*f.Distance >= 0 && *f.Distance <= math.MaxUint32)
+}
+
+func (f *VisitFields) isComplete() bool {
+	return f.Location != nil && f.User != nil && f.VisitedAt != nil && f.Mark != nil
+}
+
+func (f *VisitFields) isValid() bool {
+	if f.VisitedAt != nil && (*f.VisitedAt < 0 || *f.VisitedAt > math.MaxInt32) {
+		return false
+	}
+
+	return f.Mark == nil || (*f.Mark >= 0 && *f.Mark <= 5)
+}
+
+func (db *DataBase) CreateUser(id int, fields *UserFields) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.createUser(id, fields)
+}
+
+// createUser and the other unexported mutations expect the write lock to be
+// held, a batch runs several of them under one lock.
+func (db *DataBase) createUser(id int, fields *UserFields) error {
+	if id < 1 || id > len(db.Users)+MaxIdGap || !fields.isComplete() || !fields.isValid() {
+		return ErrInvalid
+	}
+
+	// A soft deleted user keeps its id until it is purged.
+	if id <= len(db.Users) && db.Users[id-1] != nil {
+		return ErrAlreadyExists
+	}
+
+	for len(db.Users) < id {
+		db.Users = append(db.Users, nil)
+	}
+
+	user := &User{Id: uint32(id), Version: db.nextVersion()}
+	user.apply(fields)
+
+	db.Users[id-1] = user
+
+	return nil
+}
+
+func (db *DataBase) UpdateUser(id int, fields *UserFields) error {
+	return db.UpdateUserIf(id, fields, nil)
+}
+
+func (db *DataBase) UpdateUserIf(id int, fields *UserFields, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.updateUser(id, fields, precondition)
+}
+
+func (db *DataBase) updateUser(id int, fields *UserFields, precondition Precondition) error {
+	user, isFound := db.GetUser(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(user.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if !fields.isValid() {
+		return ErrInvalid
+	}
+
+	user.apply(fields)
+	user.Version = db.nextVersion()
+
+	// Average marks of the visited locations filter by gender and age.
+	if fields.Gender != nil || fields.BirthDate != nil {
+		for _, visit := range user.VisitsIndex {
+			visit.Location.Version = user.Version
+		}
+	}
+
+	return nil
+}
+
+func (db *DataBase) CreateLocation(id int, fields *LocationFields) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.createLocation(id, fields)
+}
+
+func (db *DataBase) createLocation(id int, fields *LocationFields) error {
+	if id < 1 || id > len(db.Locations)+MaxIdGap || !fields.isComplete() || !fields.isValid() {
+		return ErrInvalid
+	}
+
+	if id <= len(db.Locations) && db.Locations[id-1] != nil {
+		return ErrAlreadyExists
+	}
+
+	for len(db.Locations) < id {
+		db.Locations = append(db.Locations, nil)
+	}
+
+	location := &Location{Id: uint32(id), Version: db.nextVersion()}
+	location.apply(fields)
+
+	db.Locations[id-1] = location
+
+	return nil
+}
+
+func (db *DataBase) UpdateLocation(id int, fields *LocationFields) error {
+	return db.UpdateLocationIf(id, fields, nil)
+}
+
+func (db *DataBase) UpdateLocationIf(id int, fields *LocationFields, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.updateLocation(id, fields, precondition)
+}
+
+func (db *DataBase) updateLocation(id int, fields *LocationFields, precondition Precondition) error {
+	location, isFound := db.GetLocation(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(location.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if !fields.isValid() {
+		return ErrInvalid
+	}
+
+	location.apply(fields)
+	location.Version = db.nextVersion()
+
+	// Visited places of the visitors show the place and filter by country and distance.
+	if fields.Place != nil || fields.Country != nil || fields.Distance != nil {
+		for _, visit := range location.VisitsIndex {
+			visit.User.Version = location.Version
+		}
+	}
+
+	return nil
+}
+
+func (db *DataBase) CreateVisit(id int, fields *VisitFields) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.createVisit(id, fields)
+}
+
+func (db *DataBase) createVisit(id int, fields *VisitFields) error {
+	if id < 1 || id > len(db.Visits)+MaxIdGap || !fields.isComplete() || !fields.isValid() {
+		return ErrInvalid
+	}
+
+	if id <= len(db.Visits) && db.Visits[id-1] != nil {
+		return ErrAlreadyExists
+	}
+
+	user, isUserFound := db.GetUser(*fields.User)
+	location, isLocationFound := db.GetLocation(*fields.Location)
+
+	if !isUserFound || !isLocationFound {
+		return ErrInvalid
+	}
+
+	for len(db.Visits) < id {
+		db.Visits = append(db.Visits, nil)
+	}
+
+	visit := &Visit{Id: uint32(id), User: user, Location: location, Version: db.nextVersion()}
+	visit.VisitedAt = *fields.VisitedAt
+	visit.Mark = int8(*fields.Mark)
+
+	db.Visits[id-1] = visit
+
+	user.Version = visit.Version
+	location.Version = visit.Version
+
+	location.VisitsIndex = append(location.VisitsIndex, visit)
+	user.insertVisit(visit)
+
+	return nil
+}
+
+func (db *DataBase) UpdateVisit(id int, fields *VisitFields) error {
+	return db.UpdateVisitIf(id, fields, nil)
+}
+
+func (db *DataBase) UpdateVisitIf(id int, fields *VisitFields, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.updateVisit(id, fields, precondition)
+}
+
+func (db *DataBase) updateVisit(id int, fields *VisitFields, precondition Precondition) error {
+	visit, isFound := db.GetVisit(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(visit.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if !fields.isValid() {
+		return ErrInvalid
+	}
+
+	user := visit.User
+	location := visit.Location
+
+	if fields.User != nil {
+		if user, isFound = db.GetUser(*fields.User); !isFound {
+			return ErrInvalid
+		}
+	}
+
+	if fields.Location != nil {
+		if location, isFound = db.GetLocation(*fields.Location); !isFound {
+			return ErrInvalid
+		}
+	}
+
+	visit.Version = db.nextVersion()
+
+	// Both the previous and the new owners change their aggregates.
+	visit.User.Version = visit.Version
+	visit.Location.Version = visit.Version
+	user.Version = visit.Version
+	location.Version = visit.Version
+
+	visit.User.removeVisit(visit)
+
+	if location != visit.Location {
+		visit.Location.removeVisit(visit)
+		location.VisitsIndex = append(location.VisitsIndex, visit)
+		visit.Location = location
+	}
+
+	visit.User = user
+
+	if fields.VisitedAt != nil {
+		visit.VisitedAt = *fields.VisitedAt
+	}
+
+	if fields.Mark != nil {
+		visit.Mark = int8(*fields.Mark)
+	}
+
+	user.insertVisit(visit)
+
+	return nil
+}
+
+func (db *DataBase) DeleteUser(id int, policy DeletePolicy, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	user, isFound := db.GetUser(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(user.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if policy != CascadeDelete && hasLiveVisits(user.VisitsIndex) {
+		return ErrHasVisits
+	}
+
+	db.removeUser(user, db.nextVersion())
+
+	return nil
+}
+
+func (db *DataBase) DeleteLocation(id int, policy DeletePolicy, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	location, isFound := db.GetLocation(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(location.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if policy != CascadeDelete && hasLiveVisits(location.VisitsIndex) {
+		return ErrHasVisits
+	}
+
+	db.removeLocation(location, db.nextVersion())
+
+	return nil
+}
+
+func (db *DataBase) DeleteVisit(id int, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	visit, isFound := db.GetVisit(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(visit.Version) {
+		return ErrPreconditionFailed
+	}
+
+	db.removeVisit(visit, db.nextVersion())
+
+	return nil
+}
+
+// removeUser, removeLocation and removeVisit drop entities from storage for
+// good, soft deleted visits of a removed user or location included.
+func (db *DataBase) removeUser(user *User, version uint64) {
+	for _, visit := range user.VisitsIndex {
+		visit.Location.removeVisit(visit)
+		visit.Location.Version = version
+		db.Visits[visit.Id-1] = nil
+		delete(db.tombstones, tombstoneKey{VisitEntity, int(visit.Id)})
+	}
+
+	db.Users[user.Id-1] = nil
+	delete(db.tombstones, tombstoneKey{UserEntity, int(user.Id)})
+}
+
+func (db *DataBase) removeLocation(location *Location, version uint64) {
+	for _, visit := range location.VisitsIndex {
+		visit.User.removeVisit(visit)
+		visit.User.Version = version
+		db.Visits[visit.Id-1] = nil
+		delete(db.tombstones, tombstoneKey{VisitEntity, int(visit.Id)})
+	}
+
+	db.Locations[location.Id-1] = nil
+	delete(db.tombstones, tombstoneKey{LocationEntity, int(location.Id)})
+}
+
+func (db *DataBase) removeVisit(visit *Visit, version uint64) {
+	visit.User.removeVisit(visit)
+	visit.User.Version = version
+	visit.Location.removeVisit(visit)
+	visit.Location.Version = version
+
+	db.Visits[visit.Id-1] = nil
+	delete(db.tombstones, tombstoneKey{VisitEntity, int(visit.Id)})
+}
+
+func hasLiveVisits(visits []*Visit) bool {
+	for _, visit := range visits {
+		if !visit.IsDeleted {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (u *User) apply(fields *UserFields) {
+	if fields.Email != nil {
+		u.Email = *fields.Email
+	}
+
+	if fields.FirstName != nil {
+		u.FirstName = *fields.FirstName
+	}
+
+	if fields.LastName != nil {
+		u.LastName = *fields.LastName
+	}
+
+	if fields.Gender != nil {
+		u.Gender = *fields.Gender
+	}
+
+	if fields.BirthDate != nil {
+		u.BirthDate = *fields.BirthDate
+	}
+}
+
+func (l *Location) apply(fields *LocationFields) {
+	if fields.Place != nil {
+		l.Place = *fields.Place
+	}
+
+	if fields.Country != nil {
+		l.Country = *fields.Country
+	}
+
+	if fields.City != nil {
+		l.City = *fields.City
+	}
+
+	if fields.Distance != nil {
+		l.Distance = uint32(*fields.Distance)
+	}
+}
+
+// insertVisit keeps VisitsIndex ordered by VisitedAt, which GetVisitedPlaces relies on.
+func (u *User) insertVisit(visit *Visit) {
+	index := sort.Search(len(u.VisitsIndex), func(i int) bool {
+		return u.VisitsIndex[i].VisitedAt > visit.VisitedAt
+	})
+
+	u.VisitsIndex = append(u.VisitsIndex, nil)
+	copy(u.VisitsIndex[index+1:], u.VisitsIndex[index:])
+	u.VisitsIndex[index] = visit
+}
+
+func (u *User) removeVisit(visit *Visit) {
+	u.VisitsIndex = removeVisit(u.VisitsIndex, visit)
+}
+
+func (l *Location) removeVisit(visit *Visit) {
+	l.VisitsIndex = removeVisit(l.VisitsIndex, visit)
+}
+
+func removeVisit(visits []*Visit, visit *Visit) []*Visit {
+	for index := range visits {
+		if visits[index] == visit {
+			copy(visits[index:], visits[index+1:])
+			visits[len(visits)-1] = nil
+			return visits[:len(visits)-1]
+		}
+	}
+
+	return visits
+}
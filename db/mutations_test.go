@@ -0,0 +1,533 @@
+package db_test
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"testing"
+	"time"
+)
+
+func TestDataBase_Versions(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	for id := 1; id <= 2; id++ {
+		userFields := &db.UserFields{
+			Email:     stringPtr("user@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    stringPtr("m"),
+			BirthDate: intPtr(0),
+		}
+
+		locationFields := &db.LocationFields{
+			Place:    stringPtr("Park"),
+			Country:  stringPtr("Russia"),
+			City:     stringPtr("Moscow"),
+			Distance: intPtr(10),
+		}
+
+		if database.CreateUser(id, userFields) != nil || database.CreateLocation(id, locationFields) != nil {
+			t.Fatal("cannot create entities")
+		}
+	}
+
+	visitFields := &db.VisitFields{User: intPtr(1), Location: intPtr(1), VisitedAt: intPtr(1000000000), Mark: intPtr(3)}
+
+	if err := database.CreateVisit(1, visitFields); err != nil {
+		t.Fatal(err)
+	}
+
+	firstUser, _ := database.GetUser(1)
+	secondUser, _ := database.GetUser(2)
+	firstLocation, _ := database.GetLocation(1)
+	secondLocation, _ := database.GetLocation(2)
+	visit, _ := database.GetVisit(1)
+
+	tests := []struct {
+		name    string
+		mutate  func() error
+		changed []*uint64
+		kept    []*uint64
+	}{
+		{
+			name:    "create visit",
+			mutate:  func() error { return database.CreateVisit(2, visitFields) },
+			changed: []*uint64{&firstUser.Version, &firstLocation.Version},
+			kept:    []*uint64{&secondUser.Version, &secondLocation.Version, &visit.Version},
+		},
+		{
+			name:    "update visit mark",
+			mutate:  func() error { return database.UpdateVisit(1, &db.VisitFields{Mark: intPtr(5)}) },
+			changed: []*uint64{&visit.Version, &firstUser.Version, &firstLocation.Version},
+			kept:    []*uint64{&secondUser.Version, &secondLocation.Version},
+		},
+		{
+			name:    "move visit",
+			mutate:  func() error { return database.UpdateVisit(1, &db.VisitFields{User: intPtr(2), Location: intPtr(2)}) },
+			changed: []*uint64{&visit.Version, &firstUser.Version, &secondUser.Version, &firstLocation.Version, &secondLocation.Version},
+		},
+		{
+			name:    "update user email",
+			mutate:  func() error { return database.UpdateUser(2, &db.UserFields{Email: stringPtr("other@example.com")}) },
+			changed: []*uint64{&secondUser.Version},
+			kept:    []*uint64{&secondLocation.Version, &visit.Version},
+		},
+		{
+			name:    "update user gender",
+			mutate:  func() error { return database.UpdateUser(2, &db.UserFields{Gender: stringPtr("f")}) },
+			changed: []*uint64{&secondUser.Version, &secondLocation.Version},
+			kept:    []*uint64{&firstLocation.Version, &visit.Version},
+		},
+		{
+			name:    "update location city",
+			mutate:  func() error { return database.UpdateLocation(2, &db.LocationFields{City: stringPtr("Tver")}) },
+			changed: []*uint64{&secondLocation.Version},
+			kept:    []*uint64{&secondUser.Version, &visit.Version},
+		},
+		{
+			name:    "update location place",
+			mutate:  func() error { return database.UpdateLocation(2, &db.LocationFields{Place: stringPtr("Museum")}) },
+			changed: []*uint64{&secondLocation.Version, &secondUser.Version},
+			kept:    []*uint64{&firstUser.Version, &visit.Version},
+		},
+		{
+			name:   "invalid update",
+			mutate: func() error { database.UpdateVisit(1, &db.VisitFields{Mark: intPtr(9)}); return nil },
+			kept:   []*uint64{&visit.Version, &secondUser.Version, &secondLocation.Version},
+		},
+	}
+
+	for _, test := range tests {
+		before := make(map[*uint64]uint64)
+
+		for _, version := range append(test.changed, test.kept...) {
+			before[version] = *version
+		}
+
+		if err := test.mutate(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		for _, version := range test.changed {
+			if *version <= before[version] {
+				t.Errorf("%s: version %d was not increased", test.name, *version)
+			}
+		}
+
+		for _, version := range test.kept {
+			if *version != before[version] {
+				t.Errorf("%s: version changed from %d to %d", test.name, before[version], *version)
+			}
+		}
+	}
+}
+
+func TestDataBase_Ranges(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	userFields := &db.UserFields{
+		Email:     stringPtr("user@example.com"),
+		FirstName: stringPtr("Name"),
+		LastName:  stringPtr("Surname"),
+		Gender:    stringPtr("m"),
+		BirthDate: intPtr(-1000000000),
+	}
+
+	locationFields := &db.LocationFields{Place: stringPtr("Park"), Country: stringPtr("Russia"), City: stringPtr("Moscow"), Distance: intPtr(10)}
+
+	if database.CreateUser(1, userFields) != nil || database.CreateLocation(1, locationFields) != nil {
+		t.Fatal("cannot create entities")
+	}
+
+	tests := []struct {
+		name   string
+		mutate func() error
+	}{
+		{"negative visited_at", func() error {
+			return database.CreateVisit(1, &db.VisitFields{User: intPtr(1), Location: intPtr(1), VisitedAt: intPtr(-10), Mark: intPtr(3)})
+		}},
+		{"visited_at past 32 bits", func() error {
+			return database.CreateVisit(1, &db.VisitFields{User: intPtr(1), Location: intPtr(1), VisitedAt: intPtr(1 << 32), Mark: intPtr(3)})
+		}},
+		{"negative distance", func() error { return database.UpdateLocation(1, &db.LocationFields{Distance: intPtr(-1)}) }},
+		{"distance past 32 bits", func() error { return database.UpdateLocation(1, &db.LocationFields{Distance: intPtr(1 << 32)}) }},
+		{"birth_date past 32 bits", func() error { return database.UpdateUser(1, &db.UserFields{BirthDate: intPtr(-1 << 32)}) }},
+	}
+
+	for _, test := range tests {
+		if err := test.mutate(); err != db.ErrInvalid {
+			t.Errorf("%s: expected ErrInvalid, got %v", test.name, err)
+		}
+	}
+
+	if _, isFound := database.GetVisit(1); isFound {
+		t.Fatal("out of range visit was created")
+	}
+
+	user, _ := database.GetUser(1)
+	location, _ := database.GetLocation(1)
+
+	if string(user.Serialize(nil)) != `{"first_name":"Name","last_name":"Surname","gender":"m","email":"user@example.com","birth_date":-1000000000,"id":1}` {
+		t.Errorf("unexpected user %s", user.Serialize(nil))
+	}
+
+	// Signed fields serialize even when they are negative.
+	visit := &db.Visit{Id: 1, User: user, Location: location, VisitedAt: -10, Mark: 3}
+
+	if string(visit.SerializeVisited(nil)) != `{"mark":3,"visited_at":-10,"place":"Park"}` {
+		t.Errorf("unexpected visit %s", visit.SerializeVisited(nil))
+	}
+}
+
+func TestDataBase_UpdateIf(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	fields := &db.UserFields{
+		Email:     stringPtr("user@example.com"),
+		FirstName: stringPtr("Name"),
+		LastName:  stringPtr("Surname"),
+		Gender:    stringPtr("m"),
+		BirthDate: intPtr(0),
+	}
+
+	if err := database.CreateUser(1, fields); err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ := database.GetUser(1)
+	version := user.Version
+
+	isVersion := func(expected uint64) db.Precondition {
+		return func(version uint64) bool { return version == expected }
+	}
+
+	if err := database.UpdateUserIf(1, &db.UserFields{FirstName: stringPtr("Other")}, isVersion(version+1)); err != db.ErrPreconditionFailed {
+		t.Fatalf("expected a failed precondition, got %v", err)
+	}
+
+	if user.FirstName != "Name" || user.Version != version {
+		t.Fatalf("user changed by a failed update: %s %d", user.FirstName, user.Version)
+	}
+
+	if err := database.UpdateUserIf(1, &db.UserFields{FirstName: stringPtr("Other")}, isVersion(version)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.UpdateUserIf(1, &db.UserFields{FirstName: stringPtr("Third")}, isVersion(version)); err != db.ErrPreconditionFailed {
+		t.Fatalf("a stale version was accepted: %v", err)
+	}
+
+	if user.FirstName != "Other" {
+		t.Fatalf("unexpected first name %s", user.FirstName)
+	}
+
+	if err := database.UpdateUserIf(2, fields, isVersion(version)); err != db.ErrNotFound {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestDataBase_Delete(t *testing.T) {
+	for _, policy := range []db.DeletePolicy{db.RejectDelete, db.CascadeDelete} {
+		database := db.NewDataBase(propertyTime, true)
+
+		for id := 1; id <= 2; id++ {
+			database.CreateUser(id, &db.UserFields{
+				Email:     stringPtr("user@example.com"),
+				FirstName: stringPtr("Name"),
+				LastName:  stringPtr("Surname"),
+				Gender:    stringPtr("m"),
+				BirthDate: intPtr(0),
+			})
+
+			database.CreateLocation(id, &db.LocationFields{
+				Place:    stringPtr("Park"),
+				Country:  stringPtr("Russia"),
+				City:     stringPtr("Moscow"),
+				Distance: intPtr(10),
+			})
+		}
+
+		// Visits 1 and 2 link user 1 with both locations, visit 3 links user 2 with location 2.
+		for id, ids := range [][2]int{{1, 1}, {1, 2}, {2, 2}} {
+			if err := database.CreateVisit(id+1, &db.VisitFields{User: intPtr(ids[0]), Location: intPtr(ids[1]), VisitedAt: intPtr(id), Mark: intPtr(3)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		secondLocation, _ := database.GetLocation(2)
+		version := secondLocation.Version
+
+		if err := database.DeleteVisit(2, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if database.IsVisitExist(2) || len(secondLocation.VisitsIndex) != 1 || secondLocation.Version == version {
+			t.Fatal("deleted visit is still indexed")
+		}
+
+		err := database.DeleteUser(1, policy, nil)
+
+		if policy == db.RejectDelete {
+			if err != db.ErrHasVisits || !database.IsUserExist(1) || !database.IsVisitExist(1) {
+				t.Fatalf("user with visits was deleted: %v", err)
+			}
+
+			continue
+		}
+
+		if err != nil || database.IsUserExist(1) || database.IsVisitExist(1) {
+			t.Fatalf("user was not deleted with its visits: %v", err)
+		}
+
+		firstLocation, _ := database.GetLocation(1)
+
+		if len(firstLocation.VisitsIndex) != 0 {
+			t.Fatal("visit of a deleted user is still indexed by its location")
+		}
+
+		if err := database.DeleteLocation(2, policy, nil); err != nil || database.IsVisitExist(3) {
+			t.Fatalf("location was not deleted with its visits: %v", err)
+		}
+
+		secondUser, _ := database.GetUser(2)
+
+		if len(secondUser.VisitsIndex) != 0 {
+			t.Fatal("visit of a deleted location is still indexed by its user")
+		}
+
+		if database.DeleteVisit(3, nil) != db.ErrNotFound || database.DeleteUser(1, policy, nil) != db.ErrNotFound {
+			t.Fatal("deleted entities can be deleted again")
+		}
+	}
+}
+
+func TestDataBase_SoftDelete(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	for id := 1; id <= 2; id++ {
+		database.CreateUser(id, &db.UserFields{
+			Email:     stringPtr("user@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    stringPtr("m"),
+			BirthDate: intPtr(0),
+		})
+
+		database.CreateLocation(id, &db.LocationFields{
+			Place:    stringPtr("Park"),
+			Country:  stringPtr("Russia"),
+			City:     stringPtr("Moscow"),
+			Distance: intPtr(10),
+		})
+	}
+
+	// Visits 1 and 2 link user 1 with both locations, visit 3 links user 2 with location 2.
+	for id, ids := range [][2]int{{1, 1}, {1, 2}, {2, 2}} {
+		if err := database.CreateVisit(id+1, &db.VisitFields{User: intPtr(ids[0]), Location: intPtr(ids[1]), VisitedAt: intPtr(id), Mark: intPtr(id + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := database.SoftDeleteVisit(3, nil); err != nil || database.IsVisitExist(3) {
+		t.Fatalf("visit was not soft deleted: %v", err)
+	}
+
+	if avg, _ := database.GetAvgMark(2, new(db.AvgMarkFilter)); avg.CountVisits != 1 {
+		t.Fatalf("soft deleted visit is counted: %+v", avg)
+	}
+
+	if err := database.SoftDeleteUser(2, db.RejectDelete, nil); err != nil {
+		t.Fatalf("user with only deleted visits was not soft deleted: %v", err)
+	}
+
+	if database.RestoreVisit(3) != db.ErrDeletedOwner {
+		t.Fatal("visit of a deleted user was restored")
+	}
+
+	if database.SoftDeleteLocation(1, db.RejectDelete, nil) != db.ErrHasVisits {
+		t.Fatal("location with live visits was soft deleted")
+	}
+
+	if err := database.SoftDeleteLocation(1, db.CascadeDelete, nil); err != nil || database.IsVisitExist(1) {
+		t.Fatalf("location was not soft deleted with its visits: %v", err)
+	}
+
+	if database.CreateLocation(1, &db.LocationFields{Place: stringPtr("Park"), Country: stringPtr("Russia"), City: stringPtr("Moscow"), Distance: intPtr(10)}) != db.ErrAlreadyExists {
+		t.Fatal("id of a soft deleted location was reused")
+	}
+
+	tombstones := database.Tombstones(nil)
+
+	if len(tombstones) != 4 {
+		t.Fatalf("unexpected tombstones %+v", tombstones)
+	}
+
+	if err := database.RestoreLocation(1); err != nil || !database.IsLocationExist(1) || !database.IsVisitExist(1) {
+		t.Fatalf("location was not restored with its visits: %v", err)
+	}
+
+	if database.RestoreLocation(1) != db.ErrNotFound {
+		t.Fatal("live location was restored")
+	}
+
+	if err := database.RestoreUser(2); err != nil || database.IsVisitExist(3) {
+		t.Fatalf("user restore brought back a visit deleted on its own: %v", err)
+	}
+
+	if err := database.RestoreVisit(3); err != nil || !database.IsVisitExist(3) {
+		t.Fatalf("visit was not restored: %v", err)
+	}
+
+	database.SoftDeleteUser(1, db.CascadeDelete, nil)
+
+	if purged := database.Purge(time.Now().Unix() - 60); purged != 0 {
+		t.Fatalf("fresh tombstones were purged: %d", purged)
+	}
+
+	if purged := database.Purge(time.Now().Unix() + 1); purged != 3 {
+		t.Fatalf("unexpected purged count %d", purged)
+	}
+
+	firstLocation, _ := database.GetLocation(1)
+
+	if len(database.Tombstones(nil)) != 0 || len(firstLocation.VisitsIndex) != 0 || database.RestoreUser(1) != db.ErrNotFound {
+		t.Fatal("purged user is still stored")
+	}
+
+	if err := database.CreateVisit(1, &db.VisitFields{User: intPtr(2), Location: intPtr(1), VisitedAt: intPtr(0), Mark: intPtr(5)}); err != nil {
+		t.Fatalf("id of a purged visit was not freed: %v", err)
+	}
+}
+
+func TestDataBase_Apply(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	newUser := func(id int, gender string) db.Operation {
+		return db.Operation{Entity: db.UserEntity, IsCreate: true, Id: id, User: &db.UserFields{
+			Email:     stringPtr("user@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    stringPtr(gender),
+			BirthDate: intPtr(0),
+		}}
+	}
+
+	newLocation := db.Operation{Entity: db.LocationEntity, IsCreate: true, Id: 1, Location: &db.LocationFields{
+		Place:    stringPtr("Park"),
+		Country:  stringPtr("Russia"),
+		City:     stringPtr("Moscow"),
+		Distance: intPtr(10),
+	}}
+
+	newVisit := db.Operation{Entity: db.VisitEntity, IsCreate: true, Id: 1, Visit: &db.VisitFields{
+		User: intPtr(1), Location: intPtr(1), VisitedAt: intPtr(100), Mark: intPtr(4),
+	}}
+
+	errs := database.Apply([]db.Operation{newUser(1, "m"), newUser(2, "x"), newLocation, newVisit}, false, nil)
+
+	if len(errs) != 4 || errs[0] != nil || errs[1] != db.ErrInvalid || errs[2] != nil || errs[3] != nil {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	if !database.IsVisitExist(1) || database.IsUserExist(2) {
+		t.Fatal("batch was not applied operation by operation")
+	}
+
+	moveVisit := db.Operation{Entity: db.VisitEntity, Id: 1, Visit: &db.VisitFields{User: intPtr(2), Mark: intPtr(1)}}
+	renameUser := db.Operation{Entity: db.UserEntity, Id: 1, User: &db.UserFields{FirstName: stringPtr("Renamed")}}
+	missingVisit := db.Operation{Entity: db.VisitEntity, Id: 5, Visit: &db.VisitFields{Mark: intPtr(1)}}
+
+	user, _ := database.GetUser(1)
+	location, _ := database.GetLocation(1)
+	visit, _ := database.GetVisit(1)
+
+	versions := []uint64{user.Version, location.Version, visit.Version}
+	countUsers := len(database.Users)
+
+	errs = database.Apply([]db.Operation{newUser(2, "f"), moveVisit, renameUser, newUser(1000, "f"), missingVisit, newUser(3, "f")}, true, errs[:0])
+
+	if len(errs) != 6 || errs[0] != db.ErrRolledBack || errs[3] != db.ErrRolledBack || errs[4] != db.ErrNotFound || errs[5] != db.ErrNotApplied {
+		t.Fatalf("unexpected atomic errors %v", errs)
+	}
+
+	if database.IsUserExist(2) || database.IsUserExist(3) || user.FirstName != "Name" || visit.User != user || visit.Mark != 4 || len(user.VisitsIndex) != 1 {
+		t.Fatal("failed atomic batch was not rolled back")
+	}
+
+	if len(database.Users) != countUsers {
+		t.Errorf("rollback left %d user slots, expected %d", len(database.Users), countUsers)
+	}
+
+	if rolledBack := []uint64{user.Version, location.Version, visit.Version}; rolledBack[0] != versions[0] || rolledBack[1] != versions[1] || rolledBack[2] != versions[2] {
+		t.Errorf("rollback changed versions from %v to %v", versions, rolledBack)
+	}
+
+	rollbackVisit := db.Operation{Entity: db.VisitEntity, IsCreate: true, Id: 2, Visit: newVisit.Visit}
+	errs = database.Apply([]db.Operation{rollbackVisit, missingVisit}, true, errs[:0])
+
+	if database.IsVisitExist(2) || len(database.Visits) != 1 || len(user.VisitsIndex) != 1 || user.Version != versions[0] || location.Version != versions[1] {
+		t.Fatal("rolled back visit create left traces")
+	}
+
+	errs = database.Apply([]db.Operation{newUser(2, "f"), moveVisit}, true, errs[:0])
+
+	if errs[0] != nil || errs[1] != nil || len(user.VisitsIndex) != 0 {
+		t.Fatalf("atomic batch was not applied: %v", errs)
+	}
+}
+
+func TestDataBase_Transaction(t *testing.T) {
+	database := db.NewDataBase(propertyTime, true)
+
+	operations := []db.Operation{
+		{Entity: db.VisitEntity, IsCreate: true, Id: 1, Visit: &db.VisitFields{User: intPtr(1), Location: intPtr(1), VisitedAt: intPtr(0), Mark: intPtr(4)}},
+		{Entity: db.UserEntity, IsCreate: true, Id: 1, User: &db.UserFields{
+			Email:     stringPtr("user@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    stringPtr("m"),
+			BirthDate: intPtr(0),
+		}},
+		{Entity: db.LocationEntity, IsCreate: true, Id: 1, Location: &db.LocationFields{
+			Place:    stringPtr("Park"),
+			Country:  stringPtr("Russia"),
+			City:     stringPtr("Moscow"),
+			Distance: intPtr(-1),
+		}},
+	}
+
+	if index, err := database.Transaction(operations); index != 2 || err != db.ErrInvalid || database.IsUserExist(1) {
+		t.Fatalf("invalid transaction was applied: %d %v", index, err)
+	}
+
+	operations[2].Location.Distance = intPtr(10)
+
+	if index, err := database.Transaction(operations); index != -1 || err != nil || !database.IsVisitExist(1) {
+		t.Fatalf("visit could not reference entities of its own transaction: %d %v", index, err)
+	}
+
+	// The updates come first, as when the update group precedes the create group.
+	operations = []db.Operation{
+		{Entity: db.UserEntity, Id: 2, User: &db.UserFields{FirstName: stringPtr("Renamed")}},
+		{Entity: db.VisitEntity, Id: 2, Visit: &db.VisitFields{Mark: intPtr(1)}},
+		{Entity: db.VisitEntity, IsCreate: true, Id: 2, Visit: &db.VisitFields{User: intPtr(2), Location: intPtr(1), VisitedAt: intPtr(0), Mark: intPtr(4)}},
+		{Entity: db.UserEntity, IsCreate: true, Id: 2, User: &db.UserFields{
+			Email:     stringPtr("other@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    stringPtr("f"),
+			BirthDate: intPtr(0),
+		}},
+	}
+
+	if index, err := database.Transaction(operations); index != -1 || err != nil {
+		t.Fatalf("update could not reference entities of its own transaction: %d %v", index, err)
+	}
+
+	if user, _ := database.GetUser(2); user.FirstName != "Renamed" {
+		t.Fatalf("update was not applied after the create: %q", user.FirstName)
+	}
+
+	if visit, _ := database.GetVisit(2); visit.Mark != 1 {
+		t.Fatalf("visit update was not applied after the create: %d", visit.Mark)
+	}
+}
@@ -0,0 +1,385 @@
+package db_test
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// The tests below build random datasets, mutate them through the public API
+// and compare GetVisitedPlaces and GetAvgMark with reference implementations
+// that scan every visit and ignore the indexes. Filter semantics pinned here:
+// fromDate and toDate are inclusive, toDistance is exclusive, fromAge keeps
+// users born no later than the generation time minus fromAge years, toAge
+// keeps users born no earlier than the generation time minus toAge years, and
+// a zero value disables a filter.
+
+const propertySeeds = 50
+const propertyQueries = 300
+
+var propertyTime = time.Unix(1503695452, 0)
+var propertyCountries = []string{"Россия", "Германия", "Chile"}
+
+func TestDataBase_GetVisitedPlacesProperty(t *testing.T) {
+	for seed := int64(1); seed <= propertySeeds; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		database := randomDataBase(t, random)
+
+		for i := 0; i < propertyQueries; i++ {
+			id := randomQueryId(random, len(database.Users))
+			filter := &db.VisitedPlacesFilter{
+				FromDate:   randomDate(random, database),
+				ToDate:     randomDate(random, database),
+				Country:    randomCountry(random),
+				ToDistance: randomInt(random, 21),
+			}
+
+			visits, isFound := database.GetVisitedPlaces(id, filter, nil)
+			expectedVisits, isExpectedFound := referenceVisitedPlaces(database, id, filter)
+
+			if isFound != isExpectedFound {
+				t.Fatalf("seed %d: user %d %+v: found %t, expected %t", seed, id, *filter, isFound, isExpectedFound)
+			}
+
+			for index := 1; index < len(visits); index++ {
+				if visits[index-1].VisitedAt > visits[index].VisitedAt {
+					t.Fatalf("seed %d: user %d %+v: visits are not ordered by visited_at", seed, id, *filter)
+				}
+			}
+
+			// Visits on the same date may come in any order, only the dates are ordered.
+			sortVisits(visits)
+
+			if !isSameVisits(visits, expectedVisits) {
+				t.Fatalf("seed %d: user %d %+v: got %v, expected %v", seed, id, *filter, visitIds(visits), visitIds(expectedVisits))
+			}
+		}
+	}
+}
+
+func TestDataBase_GetAvgMarkProperty(t *testing.T) {
+	for seed := int64(1); seed <= propertySeeds; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		database := randomDataBase(t, random)
+
+		for i := 0; i < propertyQueries; i++ {
+			id := randomQueryId(random, len(database.Locations))
+			filter := &db.AvgMarkFilter{
+				FromDate: randomDate(random, database),
+				ToDate:   randomDate(random, database),
+				Gender:   []string{"", "m", "f"}[random.Intn(3)],
+				FromAge:  randomInt(random, 80),
+				ToAge:    randomInt(random, 80),
+			}
+
+			avgMark, isFound := database.GetAvgMark(id, filter)
+			expectedAvgMark, isExpectedFound := referenceAvgMark(database, id, filter)
+
+			if isFound != isExpectedFound {
+				t.Fatalf("seed %d: location %d %+v: found %t, expected %t", seed, id, *filter, isFound, isExpectedFound)
+			}
+
+			if avgMark != expectedAvgMark {
+				t.Fatalf("seed %d: location %d %+v: got %+v, expected %+v", seed, id, *filter, avgMark, expectedAvgMark)
+			}
+		}
+	}
+}
+
+func referenceVisitedPlaces(database *db.DataBase, userId int, filter *db.VisitedPlacesFilter) ([]*db.Visit, bool) {
+	if _, isFound := database.GetUser(userId); !isFound {
+		return nil, false
+	}
+
+	var visits []*db.Visit
+
+	for _, visit := range database.Visits {
+		if visit == nil || int(visit.User.Id) != userId {
+			continue
+		}
+
+		isMatched := (filter.FromDate == 0 || visit.VisitedAt >= filter.FromDate) &&
+			(filter.ToDate == 0 || visit.VisitedAt <= filter.ToDate) &&
+			(filter.Country == "" || visit.Location.Country == filter.Country) &&
+			(filter.ToDistance == 0 || int(visit.Location.Distance) < filter.ToDistance)
+
+		if isMatched {
+			visits = append(visits, visit)
+		}
+	}
+
+	sortVisits(visits)
+
+	return visits, true
+}
+
+func referenceAvgMark(database *db.DataBase, locationId int, filter *db.AvgMarkFilter) (db.AvgMark, bool) {
+	var avgMark db.AvgMark
+
+	if _, isFound := database.GetLocation(locationId); !isFound {
+		return avgMark, false
+	}
+
+	sumOfMarks := 0
+
+	for _, visit := range database.Visits {
+		if visit == nil || int(visit.Location.Id) != locationId {
+			continue
+		}
+
+		birthDate := time.Unix(int64(visit.User.BirthDate), 0)
+
+		isMatched := (filter.FromDate == 0 || visit.VisitedAt >= filter.FromDate) &&
+			(filter.ToDate == 0 || visit.VisitedAt <= filter.ToDate) &&
+			(filter.Gender == "" || visit.User.Gender == filter.Gender) &&
+			(filter.FromAge == 0 || !birthDate.After(database.TimeDataGeneration.AddDate(-filter.FromAge, 0, 0))) &&
+			(filter.ToAge == 0 || !birthDate.Before(database.TimeDataGeneration.AddDate(-filter.ToAge, 0, 0)))
+
+		if isMatched {
+			sumOfMarks += int(visit.Mark)
+			avgMark.CountVisits++
+		}
+	}
+
+	// Round half up to five digits in integers, so float error cannot hide a change.
+	if avgMark.CountVisits != 0 {
+		rounded := (2*sumOfMarks*100000 + avgMark.CountVisits) / (2 * avgMark.CountVisits)
+		avgMark.Value = float64(rounded) / 100000
+	}
+
+	return avgMark, true
+}
+
+// randomDataBase creates users, locations and visits with ids that have gaps
+// and values that often collide on filter bounds, then applies random updates
+// so the indexes are checked after mutations as well as after loading.
+func randomDataBase(t *testing.T, random *rand.Rand) *db.DataBase {
+	database := db.NewDataBase(propertyTime, true)
+
+	countUsers := 1 + random.Intn(30)
+	countLocations := 1 + random.Intn(20)
+	countVisits := random.Intn(300)
+	countUpdates := random.Intn(50)
+
+	var userIds, locationIds []int
+
+	for id := 1; id <= countUsers; id++ {
+		if random.Intn(10) == 0 {
+			continue
+		}
+
+		gender := []string{"m", "f"}[random.Intn(2)]
+		birthDate := randomBirthDate(random)
+
+		err := database.CreateUser(id, &db.UserFields{
+			Email:     stringPtr("user@example.com"),
+			FirstName: stringPtr("Name"),
+			LastName:  stringPtr("Surname"),
+			Gender:    &gender,
+			BirthDate: &birthDate,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		userIds = append(userIds, id)
+	}
+
+	for id := 1; id <= countLocations; id++ {
+		if random.Intn(10) == 0 {
+			continue
+		}
+
+		country := propertyCountries[random.Intn(len(propertyCountries))]
+		distance := random.Intn(21)
+
+		err := database.CreateLocation(id, &db.LocationFields{
+			Place:    stringPtr("Place"),
+			Country:  &country,
+			City:     stringPtr("City"),
+			Distance: &distance,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		locationIds = append(locationIds, id)
+	}
+
+	if len(userIds) == 0 || len(locationIds) == 0 {
+		return database
+	}
+
+	var visitIds []int
+
+	for id := 1; id <= countVisits; id++ {
+		if random.Intn(10) == 0 {
+			continue
+		}
+
+		err := database.CreateVisit(id, &db.VisitFields{
+			Location:  intPtr(locationIds[random.Intn(len(locationIds))]),
+			User:      intPtr(userIds[random.Intn(len(userIds))]),
+			VisitedAt: intPtr(randomVisitedAt(random)),
+			Mark:      intPtr(random.Intn(6)),
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		visitIds = append(visitIds, id)
+	}
+
+	for i := 0; i < countUpdates; i++ {
+		var err error
+
+		switch random.Intn(3) {
+		case 0:
+			err = database.UpdateUser(userIds[random.Intn(len(userIds))], &db.UserFields{
+				Gender:    stringPtr([]string{"m", "f"}[random.Intn(2)]),
+				BirthDate: intPtr(randomBirthDate(random)),
+			})
+		case 1:
+			err = database.UpdateLocation(locationIds[random.Intn(len(locationIds))], &db.LocationFields{
+				Country:  stringPtr(propertyCountries[random.Intn(len(propertyCountries))]),
+				Distance: intPtr(random.Intn(21)),
+			})
+		default:
+			if len(visitIds) == 0 {
+				continue
+			}
+
+			fields := new(db.VisitFields)
+
+			if random.Intn(2) == 0 {
+				fields.User = intPtr(userIds[random.Intn(len(userIds))])
+			}
+
+			if random.Intn(2) == 0 {
+				fields.Location = intPtr(locationIds[random.Intn(len(locationIds))])
+			}
+
+			if random.Intn(2) == 0 {
+				fields.VisitedAt = intPtr(randomVisitedAt(random))
+			}
+
+			if random.Intn(2) == 0 {
+				fields.Mark = intPtr(random.Intn(6))
+			}
+
+			err = database.UpdateVisit(visitIds[random.Intn(len(visitIds))], fields)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return database
+}
+
+// randomBirthDate is often exactly a whole number of years before the
+// generation time, which is where fromAge and toAge flip.
+func randomBirthDate(random *rand.Rand) int {
+	birthDate := int(propertyTime.AddDate(-random.Intn(80), 0, 0).Unix())
+
+	switch random.Intn(4) {
+	case 0:
+		return birthDate
+	case 1:
+		return birthDate - 1
+	case 2:
+		return birthDate + 1
+	default:
+		return birthDate - random.Intn(365*86400)
+	}
+}
+
+// randomVisitedAt picks one of few dates so visits share dates and bounds.
+func randomVisitedAt(random *rand.Rand) int {
+	return 1000000000 + random.Intn(40)*86400
+}
+
+func randomDate(random *rand.Rand, database *db.DataBase) int {
+	if random.Intn(2) == 0 {
+		return 0
+	}
+
+	for _, visit := range database.Visits {
+		if visit != nil && random.Intn(10) == 0 {
+			return visit.VisitedAt + random.Intn(3) - 1
+		}
+	}
+
+	return randomVisitedAt(random)
+}
+
+func randomCountry(random *rand.Rand) string {
+	switch random.Intn(3) {
+	case 0:
+		return ""
+	case 1:
+		return "Atlantis"
+	default:
+		return propertyCountries[random.Intn(len(propertyCountries))]
+	}
+}
+
+func randomInt(random *rand.Rand, max int) int {
+	if random.Intn(2) == 0 {
+		return 0
+	}
+
+	return 1 + random.Intn(max)
+}
+
+func randomQueryId(random *rand.Rand, count int) int {
+	return random.Intn(count+3) - 1
+}
+
+func sortVisits(visits []*db.Visit) {
+	sort.Slice(visits, func(i, j int) bool {
+		if visits[i].VisitedAt != visits[j].VisitedAt {
+			return visits[i].VisitedAt < visits[j].VisitedAt
+		}
+
+		return visits[i].Id < visits[j].Id
+	})
+}
+
+func isSameVisits(visits []*db.Visit, expectedVisits []*db.Visit) bool {
+	if len(visits) != len(expectedVisits) {
+		return false
+	}
+
+	for index := range visits {
+		if visits[index] != expectedVisits[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func visitIds(visits []*db.Visit) []uint32 {
+	ids := make([]uint32, len(visits))
+
+	for index, visit := range visits {
+		ids[index] = visit.Id
+	}
+
+	return ids
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrDeletedOwner = errors.New("visit user or location is deleted")
+
+const UserEntity = "user"
+const LocationEntity = "location"
+const VisitEntity = "visit"
+
+// Tombstone records a soft deleted entity until it is restored or purged.
+// Visits deleted by a cascade share the version of their user or location
+// tombstone, so restoring the owner brings back exactly those visits.
+type Tombstone struct {
+	Entity    string
+	Id        int
+	DeletedAt int64
+	version   uint64
+}
+
+type tombstoneKey struct {
+	entity string
+	id     int
+}
+
+func (db *DataBase) SoftDeleteUser(id int, policy DeletePolicy, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	user, isFound := db.GetUser(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(user.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if policy != CascadeDelete && hasLiveVisits(user.VisitsIndex) {
+		return ErrHasVisits
+	}
+
+	version := db.nextVersion()
+	deletedAt := time.Now().Unix()
+
+	for _, visit := range user.VisitsIndex {
+		if !visit.IsDeleted {
+			db.buryVisit(visit, version, deletedAt)
+		}
+	}
+
+	user.IsDeleted = true
+	user.Version = version
+	db.tombstones[tombstoneKey{UserEntity, id}] = Tombstone{UserEntity, id, deletedAt, version}
+
+	return nil
+}
+
+func (db *DataBase) SoftDeleteLocation(id int, policy DeletePolicy, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	location, isFound := db.GetLocation(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(location.Version) {
+		return ErrPreconditionFailed
+	}
+
+	if policy != CascadeDelete && hasLiveVisits(location.VisitsIndex) {
+		return ErrHasVisits
+	}
+
+	version := db.nextVersion()
+	deletedAt := time.Now().Unix()
+
+	for _, visit := range location.VisitsIndex {
+		if !visit.IsDeleted {
+			db.buryVisit(visit, version, deletedAt)
+		}
+	}
+
+	location.IsDeleted = true
+	location.Version = version
+	db.tombstones[tombstoneKey{LocationEntity, id}] = Tombstone{LocationEntity, id, deletedAt, version}
+
+	return nil
+}
+
+func (db *DataBase) SoftDeleteVisit(id int, precondition Precondition) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	visit, isFound := db.GetVisit(id)
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	if !precondition.holds(visit.Version) {
+		return ErrPreconditionFailed
+	}
+
+	db.buryVisit(visit, db.nextVersion(), time.Now().Unix())
+
+	return nil
+}
+
+// RestoreUser brings a soft deleted user back along with the visits its
+// cascade deleted, unless their location has been deleted since.
+func (db *DataBase) RestoreUser(id int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	tombstone, isFound := db.tombstones[tombstoneKey{UserEntity, id}]
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	user := db.Users[id-1]
+	version := db.nextVersion()
+
+	for _, visit := range user.VisitsIndex {
+		if visit.IsDeleted && !visit.Location.IsDeleted && db.isBuriedWith(visit, tombstone.version) {
+			db.unburyVisit(visit, version)
+		}
+	}
+
+	user.IsDeleted = false
+	user.Version = version
+	delete(db.tombstones, tombstoneKey{UserEntity, id})
+
+	return nil
+}
+
+func (db *DataBase) RestoreLocation(id int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	tombstone, isFound := db.tombstones[tombstoneKey{LocationEntity, id}]
+
+	if !isFound {
+		return ErrNotFound
+	}
+
+	location := db.Locations[id-1]
+	version := db.nextVersion()
+
+	for _, visit := range location.VisitsIndex {
+		if visit.IsDeleted && !visit.User.IsDeleted && db.isBuriedWith(visit, tombstone.version) {
+			db.unburyVisit(visit, version)
+		}
+	}
+
+	location.IsDeleted = false
+	location.Version = version
+	delete(db.tombstones, tombstoneKey{LocationEntity, id})
+
+	return nil
+}
+
+// RestoreVisit returns ErrDeletedOwner while the user or the location of the
+// visit is soft deleted, they have to be restored first.
+func (db *DataBase) RestoreVisit(id int) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, isFound := db.tombstones[tombstoneKey{VisitEntity, id}]; !isFound {
+		return ErrNotFound
+	}
+
+	visit := db.Visits[id-1]
+
+	if visit.User.IsDeleted || visit.Location.IsDeleted {
+		return ErrDeletedOwner
+	}
+
+	db.unburyVisit(visit, db.nextVersion())
+
+	return nil
+}
+
+// Tombstones appends every soft deleted entity to out, oldest first. It does
+// not lock, the caller holds RLock like for the getters.
+func (db *DataBase) Tombstones(out []Tombstone) []Tombstone {
+	start := len(out)
+
+	for _, tombstone := range db.tombstones {
+		out = append(out, tombstone)
+	}
+
+	found := out[start:]
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].DeletedAt != found[j].DeletedAt {
+			return found[i].DeletedAt < found[j].DeletedAt
+		}
+
+		if found[i].Entity != found[j].Entity {
+			return found[i].Entity < found[j].Entity
+		}
+
+		return found[i].Id < found[j].Id
+	})
+
+	return out
+}
+
+// Purge removes the entities soft deleted before the given unix time from
+// storage for good, their ids become free again. It returns how many
+// tombstones it cleared.
+func (db *DataBase) Purge(before int64) int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	countTombstones := len(db.tombstones)
+	version := db.nextVersion()
+
+	// Visits go first, removing a user or a location takes its visits along.
+	for key, tombstone := range db.tombstones {
+		if key.entity == VisitEntity && tombstone.DeletedAt < before {
+			db.removeVisit(db.Visits[key.id-1], version)
+		}
+	}
+
+	for key, tombstone := range db.tombstones {
+		if tombstone.DeletedAt >= before {
+			continue
+		}
+
+		if key.entity == UserEntity {
+			db.removeUser(db.Users[key.id-1], version)
+		} else if key.entity == LocationEntity {
+			db.removeLocation(db.Locations[key.id-1], version)
+		}
+	}
+
+	return countTombstones - len(db.tombstones)
+}
+
+func (db *DataBase) buryVisit(visit *Visit, version uint64, deletedAt int64) {
+	visit.IsDeleted = true
+	visit.Version = version
+	visit.User.Version = version
+	visit.Location.Version = version
+
+	db.tombstones[tombstoneKey{VisitEntity, int(visit.Id)}] = Tombstone{VisitEntity, int(visit.Id), deletedAt, version}
+}
+
+func (db *DataBase) unburyVisit(visit *Visit, version uint64) {
+	visit.IsDeleted = false
+	visit.Version = version
+	visit.User.Version = version
+	visit.Location.Version = version
+
+	delete(db.tombstones, tombstoneKey{VisitEntity, int(visit.Id)})
+}
+
+func (db *DataBase) isBuriedWith(visit *Visit, version uint64) bool {
+	tombstone, isFound := db.tombstones[tombstoneKey{VisitEntity, int(visit.Id)}]
+
+	return isFound && tombstone.version == version
+}
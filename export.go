@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"github.com/ArtyomNorin/hlc2017_go/exporter"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := flags.String("addr", "", "address of a running server started with -admin to export, the dataset in -data is converted when empty")
+	dataPath := flags.String("data", "/tmp/hlc/data", "dataset to convert without -addr, json or csv files")
+	optionsPath := flags.String("options", "/tmp/data/options.txt", "options.txt of the dataset to convert without -addr")
+	outPath := flags.String("out", "export/data", "directory to write users_*.json, locations_*.json and visits_*.json to")
+	outOptionsPath := flags.String("out-options", "", "path to write options.txt to, defaults to options.txt next to the -out directory")
+	zipPath := flags.String("zip", "", "write a data.zip to this path instead of the -out directory, json format only")
+	format := flags.String("format", "json", "json writes users_N.json files like the competition, csv writes users.csv, locations.csv and visits.csv")
+	entitiesPerFile := flags.Int("per-file", exporter.DefaultEntitiesPerFile, "count of entities in one json file without -addr, a server uses its own")
+	flags.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		log.Fatalf("unknown export format %q", *format)
+	}
+
+	if *format == "csv" && *zipPath != "" {
+		log.Fatalln("-zip only takes the json format")
+	}
+
+	if *outOptionsPath == "" {
+		*outOptionsPath = filepath.Join(filepath.Dir(*outPath), exporter.OptionsFileName)
+	}
+
+	if *addr != "" {
+		var err error
+
+		if *zipPath != "" {
+			err = writeFile(*zipPath, func(w io.Writer) error { return exporter.DownloadZip(*addr, w) })
+		} else if *format == "csv" {
+			err = exporter.DownloadCSV(*addr, *outPath, *outOptionsPath)
+		} else {
+			err = exporter.Download(*addr, *outPath, *outOptionsPath)
+		}
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		return
+	}
+
+	database, err := loader.Load(*dataPath, *optionsPath)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	database.SortIndexes()
+
+	if *zipPath != "" {
+		err = writeFile(*zipPath, func(w io.Writer) error { return exporter.WriteZip(w, database, *entitiesPerFile) })
+	} else if *format == "csv" {
+		err = exporter.WriteCSVDir(*outPath, *outOptionsPath, database)
+	} else {
+		err = exporter.WriteDir(*outPath, *outOptionsPath, database, *entitiesPerFile)
+	}
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	err = write(file)
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
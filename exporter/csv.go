@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var csvEntities = []string{db.UserEntity, db.LocationEntity, db.VisitEntity}
+
+// CSVFileName is users.csv, locations.csv or visits.csv, the names the loader
+// takes CSV files by.
+func CSVFileName(entity string) string {
+	return entity + "s.csv"
+}
+
+// WriteCSV writes every live entity of one kind with the header of
+// loader.UserColumns, loader.LocationColumns or loader.VisitColumns. Like
+// WriteZip it takes the read lock itself for DefaultEntitiesPerFile ids at a
+// time and writes them to w before going on.
+func WriteCSV(w io.Writer, database *db.DataBase, entity string) error {
+	var chunk bytes.Buffer
+
+	writer := csv.NewWriter(&chunk)
+	record := make([]string, 0, 6)
+
+	switch entity {
+	case db.UserEntity:
+		writer.Write(loader.UserColumns)
+	case db.LocationEntity:
+		writer.Write(loader.LocationColumns)
+	case db.VisitEntity:
+		writer.Write(loader.VisitColumns)
+	}
+
+	for firstId, isLast := 1, false; !isLast; firstId += DefaultEntitiesPerFile {
+		database.RLock()
+
+		lastId := countIds(database, entity)
+		isLast = firstId+DefaultEntitiesPerFile > lastId
+
+		if !isLast {
+			lastId = firstId + DefaultEntitiesPerFile - 1
+		}
+
+		for id := firstId; id <= lastId; id++ {
+			if record, isFound := appendRecord(record[:0], database, entity, id); isFound {
+				writer.Write(record)
+			}
+		}
+
+		database.RUnlock()
+		writer.Flush()
+
+		if _, err := w.Write(chunk.Bytes()); err != nil {
+			return err
+		}
+
+		chunk.Reset()
+	}
+
+	return writer.Error()
+}
+
+// appendRecord appends the CSV fields of a live entity.
+func appendRecord(record []string, database *db.DataBase, entity string, id int) ([]string, bool) {
+	switch entity {
+	case db.UserEntity:
+		if user, isFound := database.GetUser(id); isFound {
+			return append(record, strconv.Itoa(id), user.Email, user.FirstName, user.LastName, user.Gender, strconv.Itoa(user.BirthDate)), true
+		}
+	case db.LocationEntity:
+		if location, isFound := database.GetLocation(id); isFound {
+			return append(record, strconv.Itoa(id), location.Place, location.Country, location.City, strconv.Itoa(int(location.Distance))), true
+		}
+	case db.VisitEntity:
+		if visit, isFound := database.GetVisit(id); isFound {
+			return append(record, strconv.Itoa(id), strconv.Itoa(int(visit.Location.Id)), strconv.Itoa(int(visit.User.Id)),
+				strconv.Itoa(visit.VisitedAt), strconv.Itoa(int(visit.Mark))), true
+		}
+	}
+
+	return record, false
+}
+
+// WriteCSVDir writes users.csv, locations.csv and visits.csv into dataPath
+// and options.txt into optionsPath.
+func WriteCSVDir(dataPath string, optionsPath string, database *db.DataBase) error {
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return err
+	}
+
+	for _, entity := range csvEntities {
+		file, err := os.Create(filepath.Join(dataPath, CSVFileName(entity)))
+
+		if err != nil {
+			return err
+		}
+
+		err = WriteCSV(file, database, entity)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(optionsPath, AppendOptions(nil, database), 0644)
+}
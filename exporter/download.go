@@ -0,0 +1,140 @@
+package exporter
+
+import (
+	"fmt"
+	"github.com/buger/jsonparser"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Download copies the export of a running server at addr into dataPath and
+// optionsPath. Files are fetched one by one, so writes between them may leave
+// them out of step, DownloadZip takes a consistent snapshot.
+func Download(addr string, dataPath string, optionsPath string) error {
+	client := newClient()
+	defer client.CloseIdleConnections()
+
+	listing, err := fetch(client, addr, "/admin/export")
+
+	if err != nil {
+		return err
+	}
+
+	var names []string
+
+	_, err = jsonparser.ArrayEach(listing, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if dataType == jsonparser.String {
+			names = append(names, filepath.Base(string(value)))
+		}
+	}, "files")
+
+	if err != nil {
+		return fmt.Errorf("%s/admin/export: %v", addr, err)
+	}
+
+	return downloadFiles(client, addr, names, dataPath, optionsPath)
+}
+
+// DownloadCSV is Download for users.csv, locations.csv and visits.csv.
+func DownloadCSV(addr string, dataPath string, optionsPath string) error {
+	client := newClient()
+	defer client.CloseIdleConnections()
+
+	var names []string
+
+	for _, entity := range csvEntities {
+		names = append(names, CSVFileName(entity))
+	}
+
+	return downloadFiles(client, addr, names, dataPath, optionsPath)
+}
+
+// DownloadZip copies data.zip of a running server at addr into w.
+func DownloadZip(addr string, w io.Writer) error {
+	client := newClient()
+	defer client.CloseIdleConnections()
+
+	return copyTo(w, client, addr, "/admin/export/data.zip")
+}
+
+func downloadFiles(client *http.Client, addr string, names []string, dataPath string, optionsPath string) error {
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		file, err := os.Create(filepath.Join(dataPath, name))
+
+		if err != nil {
+			return err
+		}
+
+		err = copyTo(file, client, addr, "/admin/export/"+name)
+
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	options, err := fetch(client, addr, "/admin/export/"+OptionsFileName)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(optionsPath, options, 0644)
+}
+
+// newClient keeps its connections to itself, so they can be closed once
+// the export is downloaded instead of lingering in the default pool.
+func newClient() *http.Client {
+	return &http.Client{Transport: new(http.Transport)}
+}
+
+// copyTo is fetch for the large files of an export, they are copied into w
+// as they arrive.
+func copyTo(w io.Writer, client *http.Client, addr string, path string) error {
+	response, err := client.Get("http://" + addr + path)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("%s%s: status %d", addr, path, response.StatusCode)
+	}
+
+	_, err = io.Copy(w, response.Body)
+
+	return err
+}
+
+func fetch(client *http.Client, addr string, path string) ([]byte, error) {
+	response, err := client.Get("http://" + addr + path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	content, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("%s%s: status %d", addr, path, response.StatusCode)
+	}
+
+	return content, nil
+}
@@ -0,0 +1,287 @@
+package exporter
+
+import (
+	"archive/zip"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/valyala/fasthttp"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const DefaultEntitiesPerFile = 10000
+
+const OptionsFileName = "options.txt"
+
+// File is one users_N.json, locations_N.json or visits_N.json of an export.
+// File N holds the live entities with ids from (N-1)*entitiesPerFile+1 to
+// N*entitiesPerFile, ranges without any are not exported since the loader
+// does not take empty files.
+type File struct {
+	Entity string
+	Number int
+}
+
+func (f File) Name() string {
+	return fmt.Sprintf("%ss_%d.json", f.Entity, f.Number)
+}
+
+// Files, Exists, AppendFile and WriteDir do not lock, the caller holds
+// DataBase.RLock so the files agree with each other.
+func Files(database *db.DataBase, entitiesPerFile int) []File {
+	var files []File
+
+	for _, entity := range []string{db.UserEntity, db.LocationEntity, db.VisitEntity} {
+		count := countIds(database, entity)
+
+		for number := 1; (number-1)*entitiesPerFile < count; number++ {
+			if Exists(database, File{entity, number}, entitiesPerFile) {
+				files = append(files, File{entity, number})
+			}
+		}
+	}
+
+	return files
+}
+
+// Exists tells whether file has any live entity and so is exported.
+func Exists(database *db.DataBase, file File, entitiesPerFile int) bool {
+	countFiles := (countIds(database, file.Entity) + entitiesPerFile - 1) / entitiesPerFile
+
+	if file.Number < 1 || file.Number > countFiles {
+		return false
+	}
+
+	for id := (file.Number-1)*entitiesPerFile + 1; id <= file.Number*entitiesPerFile; id++ {
+		if isLive(database, file.Entity, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AppendFile appends the content of file in the layout of the competition
+// files, which is the only one the loader parses.
+func AppendFile(out []byte, database *db.DataBase, file File, entitiesPerFile int) []byte {
+	out, _ = appendFile(out, database, file, entitiesPerFile, nil)
+
+	return out
+}
+
+// writtenIds are the users and locations a streamed export has written so far.
+type writtenIds struct {
+	users     []bool
+	locations []bool
+}
+
+func addId(ids *[]bool, id uint32) {
+	for len(*ids) < int(id) {
+		*ids = append(*ids, false)
+	}
+
+	(*ids)[id-1] = true
+}
+
+func hasId(ids []bool, id uint32) bool {
+	return int(id) <= len(ids) && ids[id-1]
+}
+
+// appendFile is AppendFile which counts the entities. With written it adds
+// the users and locations to it and leaves out the visits of others.
+func appendFile(out []byte, database *db.DataBase, file File, entitiesPerFile int, written *writtenIds) (_ []byte, count int) {
+	firstId := (file.Number-1)*entitiesPerFile + 1
+
+	out = append(out, `{"`...)
+	out = append(out, file.Entity...)
+	out = append(out, `s": [`...)
+
+	for id := firstId; id < firstId+entitiesPerFile; id++ {
+		if !isLive(database, file.Entity, id) {
+			continue
+		}
+
+		if file.Entity == db.VisitEntity && written != nil {
+			visit, _ := database.GetVisit(id)
+
+			if !hasId(written.users, visit.User.Id) || !hasId(written.locations, visit.Location.Id) {
+				continue
+			}
+		}
+
+		if count != 0 {
+			out = append(out, ", "...)
+		}
+
+		count++
+
+		switch file.Entity {
+		case db.UserEntity:
+			user, _ := database.GetUser(id)
+			out = appendUser(out, user)
+		case db.LocationEntity:
+			location, _ := database.GetLocation(id)
+			out = appendLocation(out, location)
+		case db.VisitEntity:
+			visit, _ := database.GetVisit(id)
+			out = appendVisit(out, visit)
+		}
+
+		if written != nil && file.Entity == db.UserEntity {
+			addId(&written.users, uint32(id))
+		} else if written != nil && file.Entity == db.LocationEntity {
+			addId(&written.locations, uint32(id))
+		}
+	}
+
+	return append(out, "]}"...), count
+}
+
+// AppendOptions appends options.txt, which the loader reads next to the data.
+func AppendOptions(out []byte, database *db.DataBase) []byte {
+	mode := "1"
+
+	if database.IsTrain {
+		mode = "0"
+	}
+
+	out = strconv.AppendInt(out, database.TimeDataGeneration.Unix(), 10)
+	out = append(out, '\n')
+	out = append(out, mode...)
+
+	return append(out, '\n')
+}
+
+// WriteZip writes the files as data.zip, the way the competition ships them.
+// It takes the read lock itself, one file at a time, and writes each file to
+// w before encoding the next, so neither writers nor memory wait for the whole
+// export. Files are then taken at different moments, visits of users or
+// locations created after their files were written are left out so that the
+// archive always loads.
+func WriteZip(w io.Writer, database *db.DataBase, entitiesPerFile int) error {
+	archive := zip.NewWriter(w)
+	buffer := make([]byte, 0, 4096)
+	modified := time.Now()
+	written := new(writtenIds)
+
+	for _, entity := range []string{db.UserEntity, db.LocationEntity, db.VisitEntity} {
+		for number, isLast := 1, false; !isLast; number++ {
+			var count int
+
+			database.RLock()
+			isLast = number*entitiesPerFile >= countIds(database, entity)
+			buffer, count = appendFile(buffer[:0], database, File{entity, number}, entitiesPerFile, written)
+			database.RUnlock()
+
+			if count == 0 {
+				continue
+			}
+
+			entry, err := archive.CreateHeader(&zip.FileHeader{Name: File{entity, number}.Name(), Method: zip.Deflate, Modified: modified})
+
+			if err != nil {
+				return err
+			}
+
+			if _, err := entry.Write(buffer); err != nil {
+				return err
+			}
+		}
+	}
+
+	return archive.Close()
+}
+
+// WriteDir writes the files into dataPath and options.txt into optionsPath.
+func WriteDir(dataPath string, optionsPath string, database *db.DataBase, entitiesPerFile int) error {
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return err
+	}
+
+	buffer := make([]byte, 0, 4096)
+
+	for _, file := range Files(database, entitiesPerFile) {
+		buffer = AppendFile(buffer[:0], database, file, entitiesPerFile)
+
+		if err := os.WriteFile(filepath.Join(dataPath, file.Name()), buffer, 0644); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(optionsPath, AppendOptions(buffer[:0], database), 0644)
+}
+
+// countIds is the largest id an entity may have, deleted ids included.
+func countIds(database *db.DataBase, entity string) int {
+	switch entity {
+	case db.UserEntity:
+		return len(database.Users)
+	case db.LocationEntity:
+		return len(database.Locations)
+	}
+
+	return len(database.Visits)
+}
+
+func isLive(database *db.DataBase, entity string, id int) (isFound bool) {
+	switch entity {
+	case db.UserEntity:
+		_, isFound = database.GetUser(id)
+	case db.LocationEntity:
+		_, isFound = database.GetLocation(id)
+	case db.VisitEntity:
+		_, isFound = database.GetVisit(id)
+	}
+
+	return isFound
+}
+
+func appendUser(out []byte, user *db.User) []byte {
+	out = append(out, `{"first_name": `...)
+	out = db.AppendJSONString(out, user.FirstName)
+	out = append(out, `, "last_name": `...)
+	out = db.AppendJSONString(out, user.LastName)
+	out = append(out, `, "birth_date": `...)
+	out = strconv.AppendInt(out, int64(user.BirthDate), 10)
+	out = append(out, `, "gender": `...)
+	out = db.AppendJSONString(out, user.Gender)
+	out = append(out, `, "id": `...)
+	out = fasthttp.AppendUint(out, int(user.Id))
+	out = append(out, `, "email": `...)
+	out = db.AppendJSONString(out, user.Email)
+
+	return append(out, '}')
+}
+
+func appendLocation(out []byte, location *db.Location) []byte {
+	out = append(out, `{"distance": `...)
+	out = fasthttp.AppendUint(out, int(location.Distance))
+	out = append(out, `, "city": `...)
+	out = db.AppendJSONString(out, location.City)
+	out = append(out, `, "place": `...)
+	out = db.AppendJSONString(out, location.Place)
+	out = append(out, `, "id": `...)
+	out = fasthttp.AppendUint(out, int(location.Id))
+	out = append(out, `, "country": `...)
+	out = db.AppendJSONString(out, location.Country)
+
+	return append(out, '}')
+}
+
+func appendVisit(out []byte, visit *db.Visit) []byte {
+	out = append(out, `{"user": `...)
+	out = fasthttp.AppendUint(out, int(visit.User.Id))
+	out = append(out, `, "location": `...)
+	out = fasthttp.AppendUint(out, int(visit.Location.Id))
+	out = append(out, `, "visited_at": `...)
+	out = strconv.AppendInt(out, int64(visit.VisitedAt), 10)
+	out = append(out, `, "id": `...)
+	out = fasthttp.AppendUint(out, int(visit.Id))
+	out = append(out, `, "mark": `...)
+	out = strconv.AppendInt(out, int64(visit.Mark), 10)
+
+	return append(out, '}')
+}
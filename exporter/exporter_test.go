@@ -0,0 +1,178 @@
+package exporter
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func generate(t *testing.T) *db.DataBase {
+	options := generator.TrainOptions()
+
+	options.CountUsers = 50
+	options.CountLocations = 30
+	options.CountVisits = 400
+
+	database, err := generator.GenerateAndLoad(t.TempDir(), options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return database
+}
+
+func TestWriteDir_RoundTrip(t *testing.T) {
+	database := generate(t)
+
+	renamed := "Quote \" brace } and ünïcode 🙂"
+
+	if err := database.UpdateUser(1, &db.UserFields{FirstName: &renamed}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Users 11 to 20 go away, so the second file of 10 users is not exported.
+	for id := 11; id <= 20; id++ {
+		if err := database.DeleteUser(id, db.CascadeDelete, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+
+	if err := WriteDir(filepath.Join(dir, "data"), filepath.Join(dir, OptionsFileName), database, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	files := Files(database, 10)
+
+	if len(files) != 4+3+40 || files[1] != (File{db.UserEntity, 3}) {
+		t.Fatalf("unexpected files %v", files)
+	}
+
+	exported, err := loader.Load(filepath.Join(dir, "data"), filepath.Join(dir, OptionsFileName))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported.SortIndexes()
+
+	if !exported.TimeDataGeneration.Equal(database.TimeDataGeneration) || exported.IsTrain != database.IsTrain {
+		t.Fatal("options were not exported")
+	}
+
+	for _, file := range files {
+		expected := AppendFile(nil, database, file, 10)
+
+		if actual := AppendFile(nil, exported, file, 10); !bytes.Equal(actual, expected) {
+			t.Fatalf("%s differs after a round trip:\n%s\n%s", file.Name(), actual, expected)
+		}
+	}
+
+	if user, _ := exported.GetUser(1); user.FirstName != renamed {
+		t.Fatalf("unexpected name after a round trip %q", user.FirstName)
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	database := generate(t)
+
+	var archive bytes.Buffer
+
+	if err := WriteZip(&archive, database, DefaultEntitiesPerFile); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reader.File) != 3 || reader.File[0].Name != "users_1.json" || reader.File[2].Name != "visits_1.json" {
+		t.Fatalf("unexpected entries %v", reader.File)
+	}
+
+	entry, _ := reader.File[1].Open()
+	content, _ := io.ReadAll(entry)
+
+	if !bytes.Equal(content, AppendFile(nil, database, File{db.LocationEntity, 1}, DefaultEntitiesPerFile)) {
+		t.Fatalf("unexpected locations_1.json %s", content)
+	}
+}
+
+func TestWriteCSVDir_RoundTrip(t *testing.T) {
+	database := generate(t)
+
+	renamed := "Comma, \"quote\"\nand a line"
+
+	if err := database.UpdateLocation(1, &db.LocationFields{Place: &renamed}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	if err := WriteCSVDir(filepath.Join(dir, "data"), filepath.Join(dir, OptionsFileName), database); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := loader.Load(filepath.Join(dir, "data"), filepath.Join(dir, OptionsFileName))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported.SortIndexes()
+
+	for _, file := range Files(database, DefaultEntitiesPerFile) {
+		expected := AppendFile(nil, database, file, DefaultEntitiesPerFile)
+
+		if actual := AppendFile(nil, exported, file, DefaultEntitiesPerFile); !bytes.Equal(actual, expected) {
+			t.Fatalf("%s differs after a csv round trip", file.Name())
+		}
+	}
+}
+
+func TestWriteZip_LeavesOutUnwrittenOwners(t *testing.T) {
+	database := generate(t)
+	written := new(writtenIds)
+
+	// Only user 1 is written, as if the others were created after the users files.
+	appendFile(nil, database, File{db.UserEntity, 1}, 1, written)
+	appendFile(nil, database, File{db.LocationEntity, 1}, DefaultEntitiesPerFile, written)
+
+	_, count := appendFile(nil, database, File{db.VisitEntity, 1}, DefaultEntitiesPerFile, written)
+	user, _ := database.GetUser(1)
+
+	if count == 0 || count != len(user.VisitsIndex) {
+		t.Errorf("exported %d visits, user 1 has %d", count, len(user.VisitsIndex))
+	}
+}
+
+func TestWriteZip_ConcurrentWrites(t *testing.T) {
+	database := generate(t)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for number := 0; number < 200; number++ {
+			mark := number % 6
+			database.UpdateVisit(1+number, &db.VisitFields{Mark: &mark})
+		}
+	}()
+
+	for number := 0; number < 5; number++ {
+		if err := WriteZip(io.Discard, database, 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	<-done
+}
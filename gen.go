@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"log"
+	"path/filepath"
+)
+
+func runGen(args []string) {
+	options := generator.TrainOptions()
+
+	flags := flag.NewFlagSet("gen", flag.ExitOnError)
+	dataPath := flags.String("data", "data/data", "directory to write users_*.json, locations_*.json and visits_*.json to")
+	optionsPath := flags.String("options", "", "path to options.txt, defaults to options.txt next to the data directory")
+	flags.Int64Var(&options.Seed, "seed", options.Seed, "random seed")
+	flags.IntVar(&options.CountUsers, "users", options.CountUsers, "count of users")
+	flags.IntVar(&options.CountLocations, "locations", options.CountLocations, "count of locations")
+	flags.IntVar(&options.CountVisits, "visits", options.CountVisits, "count of visits")
+	flags.IntVar(&options.EntitiesPerFile, "per-file", options.EntitiesPerFile, "count of entities in one json file")
+	flags.Int64Var(&options.TimeDataGeneration, "time", options.TimeDataGeneration, "data generation timestamp written to options.txt")
+	flags.BoolVar(&options.IsTrain, "train", options.IsTrain, "mark the dataset as train in options.txt")
+	flags.Parse(args)
+
+	if *optionsPath == "" {
+		*optionsPath = filepath.Join(filepath.Dir(*dataPath), "options.txt")
+	}
+
+	if err := generator.Generate(*dataPath, *optionsPath, options); err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Printf("Generated %d users, %d locations and %d visits in %s", options.CountUsers, options.CountLocations, options.CountVisits, *dataPath)
+}
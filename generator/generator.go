@@ -0,0 +1,214 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"github.com/valyala/fasthttp"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type Options struct {
+	Seed               int64
+	CountUsers         int
+	CountLocations     int
+	CountVisits        int
+	EntitiesPerFile    int
+	TimeDataGeneration int64
+	IsTrain            bool
+}
+
+// TrainOptions matches the size of the competition train dataset.
+func TrainOptions() Options {
+	return Options{
+		Seed:               1,
+		CountUsers:         10062,
+		CountLocations:     7978,
+		CountVisits:        100620,
+		EntitiesPerFile:    10000,
+		TimeDataGeneration: 1503695452,
+		IsTrain:            true,
+	}
+}
+
+var firstNames = []string{"Иван", "Пётр", "Анна", "Мария", "Алексей", "Ольга", "John", "Emily", "Никита", "Дарья"}
+var lastNames = []string{"Иванов", "Петрова", "Смирнов", "Кузнецова", "Попов", "Smith", "Brown", "Волков", "Соколова", "Лебедев"}
+var countries = []string{"Россия", "Германия", "Испания", "Франция", "Италия", "Египет", "Турция", "Chile", "Brazil", "Japan"}
+var cities = []string{"Москва", "Берлин", "Мадрид", "Париж", "Рим", "Каир", "Анкара", "Santiago", "Rio", "Tokyo"}
+var places = []string{"Парк", "Музей", "Набережная", "Собор", "Фонтан", "Замок", "Рынок", "Beach", "Tower", "Garden"}
+
+const minBirthDate = -1262304000
+const maxBirthDate = 915148800
+const minVisitedAt = 946684800
+const maxVisitedAt = 1420070400
+
+// Generate writes users_N.json, locations_N.json and visits_N.json into
+// dataPath and options.txt into optionsPath. The same options always produce
+// the same files.
+func Generate(dataPath string, optionsPath string, options Options) error {
+	random := rand.New(rand.NewSource(options.Seed))
+
+	if err := os.MkdirAll(dataPath, 0755); err != nil {
+		return err
+	}
+
+	err := writeEntities(dataPath, "users", options.CountUsers, options.EntitiesPerFile, func(buffer []byte, id int) []byte {
+		gender := "m"
+
+		if random.Intn(2) == 1 {
+			gender = "f"
+		}
+
+		buffer = append(buffer, `{"first_name": `...)
+		buffer = db.AppendJSONString(buffer, firstNames[random.Intn(len(firstNames))])
+		buffer = append(buffer, `, "last_name": `...)
+		buffer = db.AppendJSONString(buffer, lastNames[random.Intn(len(lastNames))])
+		buffer = append(buffer, `, "birth_date": `...)
+		buffer = strconv.AppendInt(buffer, int64(minBirthDate+random.Intn(maxBirthDate-minBirthDate)), 10)
+		buffer = append(buffer, `, "gender": "`...)
+		buffer = append(buffer, gender...)
+		buffer = append(buffer, `", "id": `...)
+		buffer = fasthttp.AppendUint(buffer, id)
+		buffer = append(buffer, `, "email": "user`...)
+		buffer = fasthttp.AppendUint(buffer, id)
+		buffer = append(buffer, `@example.com"}`...)
+
+		return buffer
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writeEntities(dataPath, "locations", options.CountLocations, options.EntitiesPerFile, func(buffer []byte, id int) []byte {
+		country := random.Intn(len(countries))
+
+		buffer = append(buffer, `{"distance": `...)
+		buffer = fasthttp.AppendUint(buffer, 1+random.Intn(99))
+		buffer = append(buffer, `, "city": `...)
+		buffer = db.AppendJSONString(buffer, cities[country])
+		buffer = append(buffer, `, "place": `...)
+		buffer = db.AppendJSONString(buffer, places[random.Intn(len(places))])
+		buffer = append(buffer, `, "id": `...)
+		buffer = fasthttp.AppendUint(buffer, id)
+		buffer = append(buffer, `, "country": `...)
+		buffer = db.AppendJSONString(buffer, countries[country])
+		buffer = append(buffer, '}')
+
+		return buffer
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writeEntities(dataPath, "visits", options.CountVisits, options.EntitiesPerFile, func(buffer []byte, id int) []byte {
+		buffer = append(buffer, `{"user": `...)
+		buffer = fasthttp.AppendUint(buffer, 1+random.Intn(options.CountUsers))
+		buffer = append(buffer, `, "location": `...)
+		buffer = fasthttp.AppendUint(buffer, 1+random.Intn(options.CountLocations))
+		buffer = append(buffer, `, "visited_at": `...)
+		buffer = fasthttp.AppendUint(buffer, minVisitedAt+random.Intn(maxVisitedAt-minVisitedAt))
+		buffer = append(buffer, `, "id": `...)
+		buffer = fasthttp.AppendUint(buffer, id)
+		buffer = append(buffer, `, "mark": `...)
+		buffer = fasthttp.AppendUint(buffer, random.Intn(6))
+		buffer = append(buffer, '}')
+
+		return buffer
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writeOptions(optionsPath, options)
+}
+
+// GenerateAndLoad generates a dataset into dir and loads it, which is what
+// tests and benchmarks need instead of a downloaded competition dataset.
+func GenerateAndLoad(dir string, options Options) (*db.DataBase, error) {
+	dataPath := filepath.Join(dir, "data")
+	optionsPath := filepath.Join(dir, "options.txt")
+
+	if err := Generate(dataPath, optionsPath, options); err != nil {
+		return nil, err
+	}
+
+	database, err := loader.Load(dataPath, optionsPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	database.SortIndexes()
+
+	return database, nil
+}
+
+func writeEntities(dataPath string, name string, count int, entitiesPerFile int, serialize func(buffer []byte, id int) []byte) error {
+	if entitiesPerFile <= 0 {
+		entitiesPerFile = count
+	}
+
+	buffer := make([]byte, 0, 4096)
+
+	for fileNumber := 1; (fileNumber-1)*entitiesPerFile < count; fileNumber++ {
+		file, err := os.Create(filepath.Join(dataPath, fmt.Sprintf("%s_%d.json", name, fileNumber)))
+
+		if err != nil {
+			return err
+		}
+
+		writer := bufio.NewWriter(file)
+
+		buffer = append(buffer[:0], `{"`...)
+		buffer = append(buffer, name...)
+		buffer = append(buffer, `": [`...)
+
+		firstId := (fileNumber-1)*entitiesPerFile + 1
+
+		for id := firstId; id < firstId+entitiesPerFile && id <= count; id++ {
+			if id != firstId {
+				buffer = append(buffer, ", "...)
+			}
+
+			buffer = serialize(buffer, id)
+
+			if len(buffer) >= 4096 {
+				writer.Write(buffer)
+				buffer = buffer[:0]
+			}
+		}
+
+		buffer = append(buffer, "]}"...)
+		writer.Write(buffer)
+
+		if err := writer.Flush(); err != nil {
+			file.Close()
+			return err
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeOptions(optionsPath string, options Options) error {
+	mode := "1"
+
+	if options.IsTrain {
+		mode = "0"
+	}
+
+	content := strconv.FormatInt(options.TimeDataGeneration, 10) + "\n" + mode + "\n"
+
+	return os.WriteFile(optionsPath, []byte(content), 0644)
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func smallOptions() Options {
+	options := TrainOptions()
+
+	options.CountUsers = 50
+	options.CountLocations = 30
+	options.CountVisits = 400
+	options.EntitiesPerFile = 150
+
+	return options
+}
+
+func TestGenerate_IsDeterministic(t *testing.T) {
+	firstDir := t.TempDir()
+	secondDir := t.TempDir()
+
+	for _, dir := range []string{firstDir, secondDir} {
+		if err := Generate(filepath.Join(dir, "data"), filepath.Join(dir, "options.txt"), smallOptions()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"data/users_1.json", "data/locations_1.json", "data/visits_1.json", "data/visits_3.json", "options.txt"} {
+		first, err := os.ReadFile(filepath.Join(firstDir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := os.ReadFile(filepath.Join(secondDir, name))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s differs between runs with the same seed", name)
+		}
+	}
+}
+
+func TestGenerateAndLoad(t *testing.T) {
+	options := smallOptions()
+
+	database, err := GenerateAndLoad(t.TempDir(), options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(database.Users) != options.CountUsers || len(database.Locations) != options.CountLocations || len(database.Visits) != options.CountVisits {
+		t.Fatalf("loaded %d users, %d locations, %d visits", len(database.Users), len(database.Locations), len(database.Visits))
+	}
+
+	if database.TimeDataGeneration.Unix() != options.TimeDataGeneration || !database.IsTrain {
+		t.Errorf("unexpected options %v %v", database.TimeDataGeneration, database.IsTrain)
+	}
+
+	countIndexedVisits := 0
+
+	for _, user := range database.Users {
+		countIndexedVisits += len(user.VisitsIndex)
+
+		for index := 1; index < len(user.VisitsIndex); index++ {
+			if user.VisitsIndex[index-1].VisitedAt > user.VisitsIndex[index].VisitedAt {
+				t.Fatalf("visits of user %d are not sorted", user.Id)
+			}
+		}
+	}
+
+	if countIndexedVisits != options.CountVisits {
+		t.Errorf("indexed %d visits, expected %d", countIndexedVisits, options.CountVisits)
+	}
+
+	user, _ := database.GetUser(1)
+
+	if user.Email != "user1@example.com" || (user.Gender != "m" && user.Gender != "f") {
+		t.Errorf("unexpected user %+v", user)
+	}
+}
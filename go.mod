@@ -1,14 +1,22 @@
 module github.com/ArtyomNorin/hlc2017_go
 
+go 1.19
+
 require (
-	github.com/buger/jsonparser v0.0.0-20181115193947-bf1c66bbce23
-	github.com/kavu/go_reuseport v1.4.0 // indirect
-	github.com/klauspost/compress v1.5.0 // indirect
-	github.com/klauspost/cpuid v1.2.1 // indirect
+	github.com/buger/jsonparser v1.1.1
+	github.com/klauspost/compress v1.5.0
 	github.com/tidwall/evio v1.0.2
 	github.com/valyala/fasthttp v1.2.0
+)
+
+require (
+	github.com/kavu/go_reuseport v1.4.0 // indirect
+	github.com/klauspost/cpuid v1.2.1 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/tcplisten v0.0.0-20161114210144-ceec8f93295a // indirect
 	golang.org/x/crypto v0.0.0-20190513172903-22d7a77e9e5f // indirect
 	golang.org/x/net v0.0.0-20190514140710-3ec191127204 // indirect
+	golang.org/x/sync v0.0.0-20190423024810-112230192c58 // indirect
 	golang.org/x/sys v0.0.0-20190516110030-61b9204099cb // indirect
 	golang.org/x/text v0.3.2 // indirect
 	golang.org/x/tools v0.0.0-20190517183331-d88f79806bbd // indirect
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"github.com/ArtyomNorin/hlc2017_go/checker"
+	"github.com/ArtyomNorin/hlc2017_go/loadgen"
+	"log"
+	"os"
+	"time"
+)
+
+func runLoad(args []string) {
+	var options loadgen.Options
+	var synthOptions loadgen.SynthOptions
+
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	flags.StringVar(&options.Addr, "addr", "localhost:80", "address of the server under load")
+	flags.IntVar(&options.Connections, "connections", 16, "count of keep-alive connections")
+	flags.IntVar(&options.RPS, "rps", 0, "target total requests per second, 0 sends as fast as the connections allow")
+	flags.IntVar(&options.Requests, "requests", 0, "stop after that many requests instead of after -duration")
+	flags.DurationVar(&options.Duration, "duration", 10*time.Second, "length of the run")
+	flags.DurationVar(&options.Timeout, "timeout", 2*time.Second, "timeout of one request")
+	ammoPath := flags.String("ammo", "", "phantom ammo file to replay, requests are synthesized when empty")
+	flags.Int64Var(&synthOptions.Seed, "seed", 1, "seed of synthesized requests")
+	flags.IntVar(&synthOptions.Count, "synth", 10000, "count of distinct synthesized requests")
+	flags.IntVar(&synthOptions.CountUsers, "users", 10062, "count of users in the served dataset")
+	flags.IntVar(&synthOptions.CountLocations, "locations", 7978, "count of locations in the served dataset")
+	flags.IntVar(&synthOptions.CountVisits, "visits", 100620, "count of visits in the served dataset")
+	flags.Float64Var(&synthOptions.PostRatio, "post-ratio", 0, "share of POST updates among synthesized requests")
+	flags.Parse(args)
+
+	var ammo []checker.Ammo
+
+	if *ammoPath != "" {
+		ammoFile, err := os.Open(*ammoPath)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		ammo, err = checker.ReadAmmo(ammoFile)
+		ammoFile.Close()
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		ammo = loadgen.Synthesize(synthOptions)
+	}
+
+	report, err := loadgen.Run(options, ammo)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	report.Print(os.Stdout)
+}
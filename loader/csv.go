@@ -0,0 +1,312 @@
+package loader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Columns of users*.csv, locations*.csv and visits*.csv. A header names
+// each of them once, in any order, and nothing else.
+var UserColumns = []string{"id", "email", "first_name", "last_name", "gender", "birth_date"}
+var LocationColumns = []string{"id", "place", "country", "city", "distance"}
+var VisitColumns = []string{"id", "location", "user", "visited_at", "mark"}
+
+// maxReportedRows bounds the rows CSVError prints, it still counts them all.
+const maxReportedRows = 10
+
+// RowError is a CSV row which could not be loaded, Line counts the header as 1.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+// CSVError lists every row of a CSV file which could not be loaded, the
+// other rows are loaded.
+type CSVError struct {
+	Path string
+	Rows []RowError
+}
+
+func (e *CSVError) Error() string {
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "%s: %d bad rows", e.Path, len(e.Rows))
+
+	for index, row := range e.Rows {
+		if index == maxReportedRows {
+			message.WriteString("; ...")
+			break
+		}
+
+		fmt.Fprintf(&message, "; line %d: %v", row.Line, row.Err)
+	}
+
+	return message.String()
+}
+
+// csvRow reads the fields of one row by column name.
+type csvRow struct {
+	record  []string
+	indexes map[string]int
+}
+
+func (r *csvRow) stringValue(column string) *string {
+	value := r.record[r.indexes[column]]
+
+	return &value
+}
+
+func (r *csvRow) intValue(column string) (*int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(r.record[r.indexes[column]]))
+
+	if err != nil {
+		return nil, fmt.Errorf("column %s: must be an integer", column)
+	}
+
+	return &value, nil
+}
+
+// csvEntity tells the entity of a CSV file by its name, empty for other files.
+func csvEntity(fileName string) string {
+	switch {
+	case filepath.Ext(fileName) != ".csv":
+		return ""
+	case strings.Contains(fileName, "user"):
+		return db.UserEntity
+	case strings.Contains(fileName, "location"):
+		return db.LocationEntity
+	case strings.Contains(fileName, "visit"):
+		return db.VisitEntity
+	}
+
+	return ""
+}
+
+// LoadCSV creates the entities of one users*.csv, locations*.csv or
+// visits*.csv file, entity is db.UserEntity, db.LocationEntity or db.VisitEntity.
+func LoadCSV(database *db.DataBase, path string, entity string) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return ReadCSV(database, file, path, entity)
+}
+
+func loadCSV(v *verifier, path string, entity string) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	return readCSV(v, file, path, entity)
+}
+
+// ReadCSV is LoadCSV for a reader, path only names it in errors.
+func ReadCSV(database *db.DataBase, reader io.Reader, path string, entity string) error {
+	return readCSV(newVerifier(database, Strict), reader, path, entity)
+}
+
+// readCSV goes on after a bad row even when v is strict, so CSVError lists
+// every bad row of the file.
+func readCSV(v *verifier, reader io.Reader, path string, entity string) error {
+	var columns []string
+	var create func(row *csvRow) error
+
+	switch entity {
+	case db.UserEntity:
+		columns, create = UserColumns, v.createUserRow
+	case db.LocationEntity:
+		columns, create = LocationColumns, v.createLocationRow
+	case db.VisitEntity:
+		columns, create = VisitColumns, v.createVisitRow
+	default:
+		return fmt.Errorf("%s: unknown entity %q", path, entity)
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+
+	if err != nil {
+		return fmt.Errorf("%s: header: %v", path, err)
+	}
+
+	indexes, err := parseHeader(header, columns)
+
+	if err != nil {
+		return fmt.Errorf("%s: header: %v", path, err)
+	}
+
+	row := csvRow{indexes: indexes}
+	csvErr := &CSVError{Path: path}
+
+	for {
+		record, err := csvReader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+
+		if err != nil && !errors.As(err, &parseErr) {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+
+		if parseErr != nil {
+			if err := v.reject(path, parseErr.Line, parseErr.Err); err != nil {
+				csvErr.Rows = append(csvErr.Rows, RowError{parseErr.Line, err})
+			}
+
+			continue
+		}
+
+		line, _ := csvReader.FieldPos(0)
+		row.record = record
+
+		if err := create(&row); err != nil {
+			if err := v.reject(path, line, err); err != nil {
+				csvErr.Rows = append(csvErr.Rows, RowError{line, err})
+			}
+		}
+	}
+
+	if len(csvErr.Rows) != 0 {
+		return csvErr
+	}
+
+	return nil
+}
+
+func parseHeader(header []string, columns []string) (map[string]int, error) {
+	indexes := make(map[string]int, len(columns))
+
+	for index, name := range header {
+		// Spreadsheets often start UTF-8 files with a byte order mark.
+		if index == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+
+		name = strings.TrimSpace(name)
+
+		if !isColumn(name, columns) {
+			return nil, fmt.Errorf("column %s is unknown, expected %s", name, strings.Join(columns, ","))
+		}
+
+		if _, isDuplicate := indexes[name]; isDuplicate {
+			return nil, fmt.Errorf("column %s is repeated", name)
+		}
+
+		indexes[name] = index
+	}
+
+	for _, column := range columns {
+		if _, isFound := indexes[column]; !isFound {
+			return nil, fmt.Errorf("column %s is missing, expected %s", column, strings.Join(columns, ","))
+		}
+	}
+
+	return indexes, nil
+}
+
+func isColumn(name string, columns []string) bool {
+	for _, column := range columns {
+		if column == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *verifier) createUserRow(row *csvRow) error {
+	var fields db.UserFields
+
+	id, err := row.intValue("id")
+
+	if err != nil {
+		return err
+	}
+
+	if fields.BirthDate, err = row.intValue("birth_date"); err != nil {
+		return err
+	}
+
+	fields.Email = row.stringValue("email")
+	fields.FirstName = row.stringValue("first_name")
+	fields.LastName = row.stringValue("last_name")
+	fields.Gender = row.stringValue("gender")
+
+	return v.createUser(*id, &fields)
+}
+
+func (v *verifier) createLocationRow(row *csvRow) error {
+	var fields db.LocationFields
+
+	id, err := row.intValue("id")
+
+	if err != nil {
+		return err
+	}
+
+	if fields.Distance, err = row.intValue("distance"); err != nil {
+		return err
+	}
+
+	fields.Place = row.stringValue("place")
+	fields.Country = row.stringValue("country")
+	fields.City = row.stringValue("city")
+
+	return v.createLocation(*id, &fields)
+}
+
+func (v *verifier) createVisitRow(row *csvRow) error {
+	var fields db.VisitFields
+
+	id, err := row.intValue("id")
+
+	if err != nil {
+		return err
+	}
+
+	if fields.Location, err = row.intValue("location"); err != nil {
+		return err
+	}
+
+	if fields.User, err = row.intValue("user"); err != nil {
+		return err
+	}
+
+	if fields.VisitedAt, err = row.intValue("visited_at"); err != nil {
+		return err
+	}
+
+	if fields.Mark, err = row.intValue("mark"); err != nil {
+		return err
+	}
+
+	return v.createVisit(*id, &fields)
+}
+
+func entityError(entity string, id int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%s %d: %w", entity, id, err)
+}
@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	database := db.NewDataBase(time.Unix(0, 0), true)
+
+	users := "\ufeffid,first_name,last_name,email,gender,birth_date\n" +
+		"1,Иван,\"Smith, Jr\",ivan@example.com,m,-100\n" +
+		"2,Anna,Brown,anna@example.com,x,0\n" +
+		"3,Anna,Brown,anna@example.com,f,soon\n" +
+		"4,Anna\n" +
+		"5,\"Anna,Brown,anna@example.com,f,0\n"
+
+	err := ReadCSV(database, strings.NewReader(users), "users.csv", db.UserEntity)
+	csvErr, isCSVError := err.(*CSVError)
+
+	if !isCSVError || len(csvErr.Rows) != 4 {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for index, line := range []int{3, 4, 5, 6} {
+		if csvErr.Rows[index].Line != line {
+			t.Errorf("row error %d is on line %d, expected %d", index, csvErr.Rows[index].Line, line)
+		}
+	}
+
+	if !strings.Contains(err.Error(), "line 4: column birth_date: must be an integer") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	if user, isFound := database.GetUser(1); !isFound || user.LastName != "Smith, Jr" || user.BirthDate != -100 {
+		t.Fatalf("valid row was not loaded: %+v", user)
+	}
+
+	headers := []string{
+		"id,place,country,city",
+		"id,place,country,city,distance,rating",
+		"id,place,place,country,city,distance",
+	}
+
+	for _, header := range headers {
+		if err := ReadCSV(database, strings.NewReader(header+"\n"), "locations.csv", db.LocationEntity); err == nil || !strings.Contains(err.Error(), "header") {
+			t.Errorf("header %q was accepted: %v", header, err)
+		}
+	}
+}
+
+func TestLoad_CSV(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"options.txt":        "1503695452\n0\n",
+		"data/users.csv":     "id,email,first_name,last_name,gender,birth_date\n1,a@example.com,A,B,f,0\n",
+		"data/locations.csv": "city,country,place,distance,id\nMoscow,Russia,Park,10,1\n",
+		"data/visits.csv":    "id,location,user,visited_at,mark\n1,1,1,1000,5\n",
+	}
+
+	os.Mkdir(filepath.Join(dir, "data"), 0755)
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	database, err := Load(filepath.Join(dir, "data"), filepath.Join(dir, "options.txt"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if visit, isFound := database.GetVisit(1); !isFound || visit.Location.Place != "Park" || visit.User.Email != "a@example.com" {
+		t.Fatalf("csv files were not loaded: %+v", visit)
+	}
+}
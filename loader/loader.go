@@ -0,0 +1,226 @@
+package loader
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func ReadOptions(pathToOptions string) (timeDataGeneration time.Time, isTrain bool, err error) {
+	file, err := os.Open(pathToOptions)
+
+	if err != nil {
+		return timeDataGeneration, false, err
+	}
+
+	defer file.Close()
+
+	fileScanner := bufio.NewScanner(file)
+
+	fileScanner.Scan()
+
+	timestamp, err := strconv.Atoi(fileScanner.Text())
+
+	if err != nil {
+		return timeDataGeneration, false, err
+	}
+
+	fileScanner.Scan()
+
+	isTrain = fileScanner.Text() != "1"
+
+	return time.Unix(int64(timestamp), 0), isTrain, nil
+}
+
+// Load fails on the first bad record, see LoadVerified.
+func Load(dataPath string, pathToOptions string) (*db.DataBase, error) {
+	database, _, err := LoadVerified(dataPath, pathToOptions, Strict)
+
+	return database, err
+}
+
+// LoadVerified loads the data and reports dangling references, duplicate ids,
+// out of range fields and id gaps. A lenient load skips the bad records, the
+// report comes back with the error of a strict one too.
+func LoadVerified(dataPath string, pathToOptions string, strictness Strictness) (*db.DataBase, *Report, error) {
+	timeDataGeneration, isTrain, err := ReadOptions(pathToOptions)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	database := db.NewDataBase(timeDataGeneration, isTrain)
+	v := newVerifier(database, strictness)
+
+	err = filepath.Walk(dataPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		fileName := filepath.Base(path)
+
+		// Files are walked in lexical order, so locations and users come before visits.
+		if entity := csvEntity(fileName); entity != "" {
+			return loadCSV(v, path, entity)
+		}
+
+		if filepath.Ext(fileName) == ".csv" {
+			return nil
+		}
+
+		if strings.Contains(fileName, "user") {
+			err := ResetFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			for ParseEntity() {
+				if err := v.createUserEntity(); err != nil {
+					if err := v.reject(path, 0, err); err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+				}
+			}
+
+		} else if strings.Contains(fileName, "location") {
+			err := ResetFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			for ParseEntity() {
+				if err := v.createLocationEntity(); err != nil {
+					if err := v.reject(path, 0, err); err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+				}
+			}
+
+		} else if strings.Contains(fileName, "visit") {
+			err := ResetFile(path)
+
+			if err != nil {
+				return err
+			}
+
+			for ParseEntity() {
+				if err := v.createVisitEntity(); err != nil {
+					if err := v.reject(path, 0, err); err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+
+	v.finish()
+
+	if err != nil {
+		return nil, v.report, err
+	}
+
+	return database, v.report, nil
+}
+
+// createUserEntity, createLocationEntity and createVisitEntity create the
+// entity the parser is at, like the CSV rows.
+func (v *verifier) createUserEntity() error {
+	var fields db.UserFields
+
+	id, err := intValue("id")
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.UserEntity, err)
+	}
+
+	if fields.Email, err = stringValue("email"); err != nil {
+		return entityError(db.UserEntity, *id, err)
+	}
+
+	if fields.FirstName, err = stringValue("first_name"); err != nil {
+		return entityError(db.UserEntity, *id, err)
+	}
+
+	if fields.LastName, err = stringValue("last_name"); err != nil {
+		return entityError(db.UserEntity, *id, err)
+	}
+
+	if fields.Gender, err = stringValue("gender"); err != nil {
+		return entityError(db.UserEntity, *id, err)
+	}
+
+	if fields.BirthDate, err = intValue("birth_date"); err != nil {
+		return entityError(db.UserEntity, *id, err)
+	}
+
+	return v.createUser(*id, &fields)
+}
+
+func (v *verifier) createLocationEntity() error {
+	var fields db.LocationFields
+
+	id, err := intValue("id")
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.LocationEntity, err)
+	}
+
+	if fields.Place, err = stringValue("place"); err != nil {
+		return entityError(db.LocationEntity, *id, err)
+	}
+
+	if fields.Country, err = stringValue("country"); err != nil {
+		return entityError(db.LocationEntity, *id, err)
+	}
+
+	if fields.City, err = stringValue("city"); err != nil {
+		return entityError(db.LocationEntity, *id, err)
+	}
+
+	if fields.Distance, err = intValue("distance"); err != nil {
+		return entityError(db.LocationEntity, *id, err)
+	}
+
+	return v.createLocation(*id, &fields)
+}
+
+func (v *verifier) createVisitEntity() error {
+	var fields db.VisitFields
+
+	id, err := intValue("id")
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.VisitEntity, err)
+	}
+
+	if fields.Location, err = intValue("location"); err != nil {
+		return entityError(db.VisitEntity, *id, err)
+	}
+
+	if fields.User, err = intValue("user"); err != nil {
+		return entityError(db.VisitEntity, *id, err)
+	}
+
+	if fields.VisitedAt, err = intValue("visited_at"); err != nil {
+		return entityError(db.VisitEntity, *id, err)
+	}
+
+	if fields.Mark, err = intValue("mark"); err != nil {
+		return entityError(db.VisitEntity, *id, err)
+	}
+
+	return v.createVisit(*id, &fields)
+}
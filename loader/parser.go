@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var fileData = make([]byte, 0, 10000000)
+var entityData = make([]byte, 0, 500)
+var dataStartIndex int
+
+func ResetFile(path string) error {
+	fileData = fileData[:0]
+	entityData = entityData[:0]
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	chunk := make([]byte, 35768)
+
+	for {
+		countBytes, err := file.Read(chunk)
+
+		if err != nil {
+			if err == io.EOF {
+				break
+			} else {
+				return err
+			}
+		}
+
+		fileData = append(fileData, chunk[:countBytes]...)
+	}
+
+	resetDataStartIndex(filepath.Base(path))
+
+	return nil
+}
+
+// ResetBytes is ResetFile for data which is already in memory.
+func ResetBytes(fileName string, data []byte) {
+	fileData = append(fileData[:0], data...)
+	entityData = entityData[:0]
+
+	resetDataStartIndex(fileName)
+}
+
+func resetDataStartIndex(fileName string) {
+	dataStartIndex = 0
+
+	if strings.Contains(fileName, "user") {
+		dataStartIndex = 11
+	} else if strings.Contains(fileName, "visit") {
+		dataStartIndex = 12
+	} else if strings.Contains(fileName, "location") {
+		dataStartIndex = 15
+	}
+}
+
+func ParseEntity() bool {
+	if dataStartIndex >= len(fileData) {
+		return false
+	}
+
+	entityEndIndex := bytes.IndexByte(fileData[dataStartIndex:], '}')
+
+	if entityEndIndex == -1 {
+		dataStartIndex = len(fileData)
+		return false
+	}
+
+	entityData = fileData[dataStartIndex : dataStartIndex+entityEndIndex+1]
+
+	dataStartIndex += entityEndIndex + 3
+
+	if dataStartIndex > len(fileData) {
+		dataStartIndex = len(fileData)
+	}
+
+	return true
+}
+
+func GetIntValue(fieldName string) int {
+	value, _ := jsonparser.GetInt(entityData, fieldName)
+
+	return int(value)
+}
+
+func GetStringValue(fieldName string) string {
+	value, _ := jsonparser.GetString(entityData, fieldName)
+
+	return value
+}
+
+// intValue and stringValue are GetIntValue and GetStringValue for the loader,
+// a missing field or one of the wrong type is an ErrMalformed.
+func intValue(fieldName string) (*int, error) {
+	value, dataType, _, err := jsonparser.Get(entityData, fieldName)
+
+	if err != nil || dataType == jsonparser.Null {
+		return nil, fmt.Errorf("%w: %s is missing", ErrMalformed, fieldName)
+	}
+
+	parsed, err := jsonparser.ParseInt(value)
+
+	if dataType != jsonparser.Number || err != nil {
+		return nil, fmt.Errorf("%w: %s must be an integer", ErrMalformed, fieldName)
+	}
+
+	result := int(parsed)
+
+	return &result, nil
+}
+
+func stringValue(fieldName string) (*string, error) {
+	value, dataType, _, err := jsonparser.Get(entityData, fieldName)
+
+	if err != nil || dataType == jsonparser.Null {
+		return nil, fmt.Errorf("%w: %s is missing", ErrMalformed, fieldName)
+	}
+
+	parsed, err := jsonparser.ParseString(value)
+
+	if dataType != jsonparser.String || err != nil {
+		return nil, fmt.Errorf("%w: %s must be a string", ErrMalformed, fieldName)
+	}
+
+	return &parsed, nil
+}
@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"testing"
+)
+
+func TestParseEntity(t *testing.T) {
+	ResetBytes("users_1.json", []byte(`{"users": [{"id": 1, "first_name": "Иван"}, {"id": 2, "first_name": "John"}]}`))
+
+	var ids []int
+	var names []string
+
+	for ParseEntity() {
+		ids = append(ids, GetIntValue("id"))
+		names = append(names, GetStringValue("first_name"))
+	}
+
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 || names[0] != "Иван" || names[1] != "John" {
+		t.Errorf("unexpected entities %v %v", ids, names)
+	}
+}
+
+func FuzzParseEntity(f *testing.F) {
+	f.Add("users_1.json", []byte(`{"users": [{"id": 1, "email": "a@b.c", "birth_date": -100}, {"id": 2}]}`))
+	f.Add("locations_1.json", []byte(`{"locations": [{"distance": 1, "city": "М", "id": 1}]}`))
+	f.Add("visits_1.json", []byte(`{"visits": [{"user": 1, "location": 1, "visited_at": 1, "id": 1, "mark": 5}]}`+"\n"))
+	f.Add("visits_1.json", []byte(`{"visits": [`))
+	f.Add("options.txt", []byte("}"))
+
+	f.Fuzz(func(t *testing.T, fileName string, data []byte) {
+		ResetBytes(fileName, data)
+
+		for countEntities := 0; ParseEntity(); countEntities++ {
+			if countEntities > len(data) {
+				t.Fatalf("parsed more entities than bytes in %q", data)
+			}
+
+			GetIntValue("id")
+			GetStringValue("email")
+		}
+	})
+}
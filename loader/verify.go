@@ -0,0 +1,234 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"io"
+	"math"
+)
+
+var ErrDanglingReference = errors.New("references a missing user or location")
+var ErrDuplicateId = errors.New("id is loaded twice")
+var ErrOutOfRange = errors.New("field is out of range")
+var ErrMalformed = errors.New("field is missing or malformed")
+
+// Strictness decides what a load does with a record it cannot take.
+type Strictness int
+
+const (
+	// Strict fails the load on a bad record.
+	Strict Strictness = iota
+	// Lenient skips bad records and loads the others.
+	Lenient
+)
+
+func ParseStrictness(name string) (Strictness, error) {
+	switch name {
+	case "strict":
+		return Strict, nil
+	case "lenient":
+		return Lenient, nil
+	}
+
+	return Strict, fmt.Errorf("unknown strictness %q", name)
+}
+
+// Issue is a record which was not loaded, Line is only known for CSV files.
+type Issue struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %v", i.Path, i.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %v", i.Path, i.Line, i.Err)
+}
+
+// Report sums up what a load found. Bad records which are neither dangling
+// references, duplicate ids nor out of range fields are malformed, like ones
+// with a missing field or a field which is not a number. Id gaps
+// are ids below the largest one without an entity, exports of a dataset with
+// deletes have them, so they never fail a load.
+type Report struct {
+	Loaded             map[string]int
+	IdGaps             map[string]int
+	Skipped            int
+	DanglingReferences int
+	DuplicateIds       int
+	OutOfRange         int
+	Malformed          int
+	// Issues holds the first bad records, Skipped counts them all.
+	Issues []Issue
+}
+
+func (r *Report) Print(writer io.Writer) {
+	for _, entity := range []string{db.UserEntity, db.LocationEntity, db.VisitEntity} {
+		fmt.Fprintf(writer, "%ss: %d loaded, %d id gaps\n", entity, r.Loaded[entity], r.IdGaps[entity])
+	}
+
+	fmt.Fprintf(writer, "bad records: %d (%d dangling references, %d duplicate ids, %d out of range, %d malformed)\n",
+		r.Skipped, r.DanglingReferences, r.DuplicateIds, r.OutOfRange, r.Malformed)
+
+	for _, issue := range r.Issues {
+		fmt.Fprintln(writer, issue)
+	}
+
+	if len(r.Issues) < r.Skipped {
+		fmt.Fprintf(writer, "... and %d more\n", r.Skipped-len(r.Issues))
+	}
+}
+
+// verifier creates the loaded records and tells apart why one is bad.
+type verifier struct {
+	database   *db.DataBase
+	strictness Strictness
+	report     *Report
+}
+
+func newVerifier(database *db.DataBase, strictness Strictness) *verifier {
+	return &verifier{database: database, strictness: strictness, report: &Report{}}
+}
+
+func (v *verifier) createUser(id int, fields *db.UserFields) error {
+	if err := checkUser(fields); err != nil {
+		return entityError(db.UserEntity, id, err)
+	}
+
+	return entityError(db.UserEntity, id, classify(v.database.CreateUser(id, fields)))
+}
+
+func (v *verifier) createLocation(id int, fields *db.LocationFields) error {
+	if err := checkLocation(fields); err != nil {
+		return entityError(db.LocationEntity, id, err)
+	}
+
+	return entityError(db.LocationEntity, id, classify(v.database.CreateLocation(id, fields)))
+}
+
+func (v *verifier) createVisit(id int, fields *db.VisitFields) error {
+	if err := checkVisit(fields); err != nil {
+		return entityError(db.VisitEntity, id, err)
+	}
+
+	_, isUserFound := v.database.GetUser(*fields.User)
+	_, isLocationFound := v.database.GetLocation(*fields.Location)
+
+	// CreateVisit does not tell a missing owner from a bad field.
+	if !isUserFound || !isLocationFound {
+		return entityError(db.VisitEntity, id, fmt.Errorf("%w: user %d, location %d", ErrDanglingReference, *fields.User, *fields.Location))
+	}
+
+	return entityError(db.VisitEntity, id, classify(v.database.CreateVisit(id, fields)))
+}
+
+// reject counts a bad record, it returns the error back only when the load is strict.
+func (v *verifier) reject(path string, line int, err error) error {
+	report := v.report
+	report.Skipped++
+
+	switch {
+	case errors.Is(err, ErrDanglingReference):
+		report.DanglingReferences++
+	case errors.Is(err, ErrDuplicateId):
+		report.DuplicateIds++
+	case errors.Is(err, ErrOutOfRange):
+		report.OutOfRange++
+	default:
+		report.Malformed++
+	}
+
+	if len(report.Issues) < maxReportedRows {
+		report.Issues = append(report.Issues, Issue{path, line, err})
+	}
+
+	if v.strictness == Strict {
+		return err
+	}
+
+	return nil
+}
+
+// finish counts the loaded entities and the id gaps between them.
+func (v *verifier) finish() {
+	report := v.report
+	report.Loaded = make(map[string]int, 3)
+	report.IdGaps = make(map[string]int, 3)
+
+	for _, user := range v.database.Users {
+		if user == nil {
+			report.IdGaps[db.UserEntity]++
+		} else {
+			report.Loaded[db.UserEntity]++
+		}
+	}
+
+	for _, location := range v.database.Locations {
+		if location == nil {
+			report.IdGaps[db.LocationEntity]++
+		} else {
+			report.Loaded[db.LocationEntity]++
+		}
+	}
+
+	for _, visit := range v.database.Visits {
+		if visit == nil {
+			report.IdGaps[db.VisitEntity]++
+		} else {
+			report.Loaded[db.VisitEntity]++
+		}
+	}
+}
+
+// checkUser, checkLocation and checkVisit tell out of range fields apart
+// before the create, which rejects them like any other invalid field. Birth
+// dates and visit times have to fit the 32 bit timestamps of the entities.
+func checkUser(fields *db.UserFields) error {
+	if fields.Gender != nil && *fields.Gender != "m" && *fields.Gender != "f" {
+		return fmt.Errorf("%w: gender %q", ErrOutOfRange, *fields.Gender)
+	}
+
+	if fields.BirthDate != nil && (*fields.BirthDate < math.MinInt32 || *fields.BirthDate > math.MaxInt32) {
+		return fmt.Errorf("%w: birth_date %d", ErrOutOfRange, *fields.BirthDate)
+	}
+
+	return nil
+}
+
+func checkLocation(fields *db.LocationFields) error {
+	if fields.Distance != nil && (*fields.Distance < 0 || *fields.Distance > math.MaxUint32) {
+		return fmt.Errorf("%w: distance %d", ErrOutOfRange, *fields.Distance)
+	}
+
+	return nil
+}
+
+func checkVisit(fields *db.VisitFields) error {
+	if fields.VisitedAt != nil && (*fields.VisitedAt < 0 || *fields.VisitedAt > math.MaxInt32) {
+		return fmt.Errorf("%w: visited_at %d", ErrOutOfRange, *fields.VisitedAt)
+	}
+
+	if fields.Mark != nil && (*fields.Mark < 0 || *fields.Mark > 5) {
+		return fmt.Errorf("%w: mark %d", ErrOutOfRange, *fields.Mark)
+	}
+
+	return nil
+}
+
+// classify turns the errors of the creates into the ones of the report. Out
+// of range fields are checked before, so an invalid create is a missing field
+// or an id the database does not take.
+func classify(err error) error {
+	switch err {
+	case db.ErrAlreadyExists:
+		return ErrDuplicateId
+	case db.ErrInvalid:
+		return ErrMalformed
+	}
+
+	return err
+}
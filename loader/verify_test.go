@@ -0,0 +1,98 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadVerified(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"options.txt": "1503695452\n0\n",
+		"data/users_1.json": `{"users": [` +
+			`{"id": 1, "email": "a@example.com", "first_name": "A", "last_name": "B", "gender": "f", "birth_date": 0}, ` +
+			`{"id": 1, "email": "c@example.com", "first_name": "C", "last_name": "D", "gender": "m", "birth_date": 0}, ` +
+			`{"id": 4, "email": "e@example.com", "first_name": "E", "last_name": "F", "gender": "x", "birth_date": 0}, ` +
+			`{"email": "g@example.com", "first_name": "G", "last_name": "H", "gender": "m", "birth_date": 0}, ` +
+			`{"id": 5, "email": "i@example.com", "first_name": "I", "last_name": "J", "gender": "m"}]}`,
+		"data/locations_1.json": `{"locations": [{"id": 1, "place": "Park", "country": "Russia", "city": "Moscow", "distance": 10}]}`,
+		"data/visits_1.json": `{"visits": [` +
+			`{"id": 1, "location": 1, "user": 1, "visited_at": 1000, "mark": 5}, ` +
+			`{"id": 2, "location": 1, "user": 1, "visited_at": -10, "mark": 5}, ` +
+			`{"id": 4, "location": 1, "user": 1, "visited_at": 1000, "mark": "5"}, ` +
+			`{"id": 3, "location": 1, "user": 7, "visited_at": 1000, "mark": 5}]}`,
+	}
+
+	os.Mkdir(filepath.Join(dir, "data"), 0755)
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dataPath, optionsPath := filepath.Join(dir, "data"), filepath.Join(dir, "options.txt")
+
+	_, report, err := LoadVerified(dataPath, optionsPath, Strict)
+
+	if !errors.Is(err, ErrDuplicateId) || report == nil || report.Skipped != 1 {
+		t.Fatalf("strict load returned %v, %+v", err, report)
+	}
+
+	database, report, err := LoadVerified(dataPath, optionsPath, Lenient)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Skipped != 7 || report.DuplicateIds != 1 || report.OutOfRange != 2 || report.DanglingReferences != 1 || report.Malformed != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	if report.Loaded[db.UserEntity] != 1 || report.Loaded[db.VisitEntity] != 1 || report.IdGaps[db.VisitEntity] != 0 || database.IsVisitExist(2) {
+		t.Fatalf("unexpected counts %+v", report)
+	}
+
+	if user, isFound := database.GetUser(1); !isFound || user.Email != "a@example.com" || len(user.VisitsIndex) != 1 {
+		t.Fatalf("first user was not kept: %+v", user)
+	}
+
+	var summary bytes.Buffer
+
+	report.Print(&summary)
+
+	if !strings.Contains(summary.String(), "visits_1.json: visit 3: references a missing user or location") ||
+		!strings.Contains(summary.String(), "visits_1.json: visit 2: field is out of range: visited_at -10") ||
+		!strings.Contains(summary.String(), "users_1.json: user 5: field is missing or malformed: birth_date is missing") ||
+		!strings.Contains(summary.String(), "visits_1.json: visit 4: field is missing or malformed: mark must be an integer") {
+		t.Errorf("unexpected summary %q", summary.String())
+	}
+
+	// Without the duplicate user the strict load stops at the first out of range field.
+	os.WriteFile(filepath.Join(dataPath, "users_1.json"), []byte(`{"users": [`+
+		`{"id": 1, "email": "a@example.com", "first_name": "A", "last_name": "B", "gender": "f", "birth_date": 99999999999}]}`), 0644)
+
+	if _, report, err := LoadVerified(dataPath, optionsPath, Strict); !errors.Is(err, ErrOutOfRange) || report.Skipped != 1 {
+		t.Fatalf("strict load returned %v, %+v", err, report)
+	}
+
+	// A gap is left by a missing id below the largest loaded one.
+	database.CreateVisit(5, &db.VisitFields{Location: intPointer(1), User: intPointer(1), VisitedAt: intPointer(0), Mark: intPointer(1)})
+
+	v := newVerifier(database, Lenient)
+	v.finish()
+
+	if v.report.IdGaps[db.VisitEntity] != 3 {
+		t.Errorf("unexpected visit id gaps %d", v.report.IdGaps[db.VisitEntity])
+	}
+}
+
+func intPointer(value int) *int {
+	return &value
+}
@@ -0,0 +1,246 @@
+package loadgen
+
+import (
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/checker"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Options struct {
+	Addr        string
+	Connections int
+	// RPS limits the total request rate, zero means every connection sends
+	// its next request as soon as the previous response arrives. With a rate
+	// every request has a scheduled send time and its latency counts from
+	// there, so a slow response delays the requests queued behind it in the
+	// percentiles instead of hiding them.
+	RPS int
+	// Requests stops the run after that many requests, Duration is used when it is zero.
+	Requests int
+	Duration time.Duration
+	Timeout  time.Duration
+}
+
+type RouteStats struct {
+	Route       string
+	Count       int
+	Errors      int
+	StatusCodes map[int]int
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+	Max         time.Duration
+	latencies   []time.Duration
+}
+
+type Report struct {
+	Count      int
+	Errors     int
+	Elapsed    time.Duration
+	Throughput float64
+	Routes     []*RouteStats
+}
+
+type worker struct {
+	target *checker.TCPTarget
+	routes map[string]*RouteStats
+}
+
+// Run replays ammo round-robin over Connections keep-alive connections.
+func Run(options Options, ammo []checker.Ammo) (*Report, error) {
+	if len(ammo) == 0 {
+		return nil, fmt.Errorf("no requests to send")
+	}
+
+	if options.Connections <= 0 {
+		options.Connections = 1
+	}
+
+	var interval time.Duration
+
+	if options.RPS < 0 {
+		return nil, fmt.Errorf("rps must not be negative")
+	}
+
+	if options.RPS > 0 {
+		if interval = time.Second / time.Duration(options.RPS); interval == 0 {
+			return nil, fmt.Errorf("rps must be at most %d", time.Second)
+		}
+	}
+
+	routes := make([]string, len(ammo))
+
+	for index, item := range ammo {
+		routes[index] = checker.Route(item.Request)
+	}
+
+	var next int64 = -1
+
+	deadline := time.Now().Add(options.Duration)
+	workers := make([]*worker, options.Connections)
+
+	var waitGroup sync.WaitGroup
+
+	startedAt := time.Now()
+
+	for index := range workers {
+		workers[index] = &worker{
+			target: &checker.TCPTarget{Addr: options.Addr, Timeout: options.Timeout},
+			routes: make(map[string]*RouteStats),
+		}
+
+		waitGroup.Add(1)
+
+		go func(w *worker) {
+			defer waitGroup.Done()
+			defer w.target.Close()
+
+			for {
+				number := atomic.AddInt64(&next, 1)
+
+				if options.Requests > 0 && number >= int64(options.Requests) {
+					return
+				}
+
+				if options.Requests <= 0 && time.Now().After(deadline) {
+					return
+				}
+
+				requestStartedAt := time.Now()
+
+				if interval > 0 {
+					requestStartedAt = startedAt.Add(time.Duration(number) * interval)
+
+					if options.Requests <= 0 && requestStartedAt.After(deadline) {
+						return
+					}
+
+					time.Sleep(time.Until(requestStartedAt))
+				}
+
+				index := int(number % int64(len(ammo)))
+
+				statusCode, _, err := w.target.Do(ammo[index].Request)
+				w.record(routes[index], statusCode, err, time.Since(requestStartedAt))
+			}
+		}(workers[index])
+	}
+
+	waitGroup.Wait()
+
+	return buildReport(workers, time.Since(startedAt)), nil
+}
+
+func (w *worker) record(route string, statusCode int, err error, latency time.Duration) {
+	stats, isExist := w.routes[route]
+
+	if !isExist {
+		stats = &RouteStats{Route: route, StatusCodes: make(map[int]int)}
+		w.routes[route] = stats
+	}
+
+	stats.Count++
+
+	if err != nil || statusCode >= 500 {
+		stats.Errors++
+	}
+
+	if err == nil {
+		stats.StatusCodes[statusCode]++
+	}
+
+	stats.latencies = append(stats.latencies, latency)
+}
+
+func buildReport(workers []*worker, elapsed time.Duration) *Report {
+	report := &Report{Elapsed: elapsed}
+	routes := make(map[string]*RouteStats)
+
+	for _, w := range workers {
+		for route, workerStats := range w.routes {
+			stats, isExist := routes[route]
+
+			if !isExist {
+				stats = &RouteStats{Route: route, StatusCodes: make(map[int]int)}
+				routes[route] = stats
+				report.Routes = append(report.Routes, stats)
+			}
+
+			stats.Count += workerStats.Count
+			stats.Errors += workerStats.Errors
+			stats.latencies = append(stats.latencies, workerStats.latencies...)
+
+			for statusCode, count := range workerStats.StatusCodes {
+				stats.StatusCodes[statusCode] += count
+			}
+		}
+	}
+
+	for _, stats := range report.Routes {
+		sort.Slice(stats.latencies, func(i, j int) bool { return stats.latencies[i] < stats.latencies[j] })
+
+		stats.P50 = percentile(stats.latencies, 50)
+		stats.P90 = percentile(stats.latencies, 90)
+		stats.P99 = percentile(stats.latencies, 99)
+		stats.Max = percentile(stats.latencies, 100)
+
+		report.Count += stats.Count
+		report.Errors += stats.Errors
+	}
+
+	sort.Slice(report.Routes, func(i, j int) bool { return report.Routes[i].Route < report.Routes[j].Route })
+
+	if elapsed > 0 {
+		report.Throughput = float64(report.Count) / elapsed.Seconds()
+	}
+
+	return report
+}
+
+// percentile expects sorted latencies and uses the nearest-rank method.
+func percentile(latencies []time.Duration, rank int) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+
+	index := (len(latencies)*rank + 99) / 100
+
+	if index < 1 {
+		index = 1
+	}
+
+	return latencies[index-1]
+}
+
+func (r *Report) Print(writer io.Writer) {
+	fmt.Fprintf(writer, "%-30s %9s %7s %10s %10s %10s %10s %8s\n", "route", "requests", "errors", "p50", "p90", "p99", "max", "rps")
+
+	for _, stats := range r.Routes {
+		fmt.Fprintf(writer, "%-30s %9d %7d %10s %10s %10s %10s %8.0f\n", stats.Route, stats.Count, stats.Errors,
+			stats.P50, stats.P90, stats.P99, stats.Max, float64(stats.Count)/r.Elapsed.Seconds())
+	}
+
+	fmt.Fprintf(writer, "total: %d requests, %d errors in %s, %.0f rps\n", r.Count, r.Errors, r.Elapsed.Round(time.Millisecond), r.Throughput)
+
+	for _, stats := range r.Routes {
+		statusCodes := make([]int, 0, len(stats.StatusCodes))
+
+		for statusCode := range stats.StatusCodes {
+			statusCodes = append(statusCodes, statusCode)
+		}
+
+		sort.Ints(statusCodes)
+
+		fmt.Fprintf(writer, "%-30s", stats.Route)
+
+		for _, statusCode := range statusCodes {
+			fmt.Fprintf(writer, " %d: %d", statusCode, stats.StatusCodes[statusCode])
+		}
+
+		fmt.Fprintln(writer)
+	}
+}
@@ -0,0 +1,97 @@
+package loadgen
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/checker"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+
+	for index := range latencies {
+		latencies[index] = time.Duration(index+1) * time.Millisecond
+	}
+
+	if percentile(latencies, 50) != 50*time.Millisecond || percentile(latencies, 99) != 99*time.Millisecond || percentile(latencies, 100) != 100*time.Millisecond {
+		t.Errorf("unexpected percentiles %s %s %s", percentile(latencies, 50), percentile(latencies, 99), percentile(latencies, 100))
+	}
+
+	if percentile(latencies[:1], 50) != time.Millisecond || percentile(nil, 50) != 0 {
+		t.Error("unexpected percentile of short input")
+	}
+}
+
+func TestRun(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/users/") {
+			w.Write([]byte(`{}`))
+			return
+		}
+
+		http.NotFound(w, r)
+	}))
+	defer httpServer.Close()
+
+	ammo := Synthesize(SynthOptions{Seed: 1, Count: 100, CountUsers: 10, CountLocations: 10, CountVisits: 10, PostRatio: 0.2})
+
+	options := Options{Addr: strings.TrimPrefix(httpServer.URL, "http://"), Connections: 4, Requests: 300}
+
+	report, err := Run(options, ammo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Count != 300 || report.Errors != 0 {
+		t.Fatalf("unexpected totals %d requests %d errors", report.Count, report.Errors)
+	}
+
+	for _, stats := range report.Routes {
+		if strings.Contains(stats.Route, "/users/") && stats.StatusCodes[200] != stats.Count {
+			t.Errorf("%s: unexpected status codes %v", stats.Route, stats.StatusCodes)
+		}
+
+		if stats.P50 > stats.P99 || stats.P99 > stats.Max {
+			t.Errorf("%s: percentiles are not ordered", stats.Route)
+		}
+	}
+}
+
+func TestRun_RPS(t *testing.T) {
+	var isFirst int32 = 1
+
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.CompareAndSwapInt32(&isFirst, 1, 0) {
+			time.Sleep(60 * time.Millisecond)
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+	defer httpServer.Close()
+
+	ammo := []checker.Ammo{{Request: []byte("GET /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n")}}
+	options := Options{Addr: strings.TrimPrefix(httpServer.URL, "http://"), Connections: 1, Requests: 10, RPS: 100}
+
+	report, err := Run(options, ammo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The requests scheduled while the first one stalls wait for it, their
+	// latencies count from the schedule and not from the late send.
+	if stats := report.Routes[0]; stats.Count != 10 || stats.P90 < 40*time.Millisecond {
+		t.Errorf("queued requests are not measured from their schedule: %+v", stats)
+	}
+
+	options.RPS = 2000000000
+
+	if _, err := Run(options, ammo); err == nil {
+		t.Error("rps above one per nanosecond was accepted")
+	}
+}
@@ -0,0 +1,111 @@
+package loadgen
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/checker"
+	"math/rand"
+	"net/url"
+	"strconv"
+)
+
+type SynthOptions struct {
+	Seed           int64
+	Count          int
+	CountUsers     int
+	CountLocations int
+	CountVisits    int
+	// PostRatio is the share of update requests among the synthesized ones.
+	PostRatio float64
+}
+
+var synthCountries = []string{"Россия", "Германия", "Испания", "Chile", "Japan"}
+
+// Synthesize builds a phase-like mix of requests for ids inside the given
+// dataset bounds. A small share of ids is out of range to exercise 404s.
+func Synthesize(options SynthOptions) []checker.Ammo {
+	random := rand.New(rand.NewSource(options.Seed))
+	ammo := make([]checker.Ammo, 0, options.Count)
+
+	randomId := func(count int) int {
+		return 1 + random.Intn(count+count/100+1)
+	}
+
+	for len(ammo) < options.Count {
+		var item checker.Ammo
+
+		if random.Float64() < options.PostRatio {
+			switch random.Intn(3) {
+			case 0:
+				item.Tag = "POST:/users/<id>"
+				item.Request = postRequest("/users/"+strconv.Itoa(randomId(options.CountUsers)),
+					`{"email": "load`+strconv.Itoa(random.Intn(1000000))+`@example.com"}`)
+			case 1:
+				item.Tag = "POST:/locations/<id>"
+				item.Request = postRequest("/locations/"+strconv.Itoa(randomId(options.CountLocations)),
+					`{"distance": `+strconv.Itoa(1+random.Intn(99))+`}`)
+			default:
+				item.Tag = "POST:/visits/<id>"
+				item.Request = postRequest("/visits/"+strconv.Itoa(randomId(options.CountVisits)),
+					`{"mark": `+strconv.Itoa(random.Intn(6))+`}`)
+			}
+		} else {
+			switch random.Intn(5) {
+			case 0:
+				item.Tag = "GET:/users/<id>"
+				item.Request = getRequest("/users/" + strconv.Itoa(randomId(options.CountUsers)))
+			case 1:
+				item.Tag = "GET:/locations/<id>"
+				item.Request = getRequest("/locations/" + strconv.Itoa(randomId(options.CountLocations)))
+			case 2:
+				item.Tag = "GET:/visits/<id>"
+				item.Request = getRequest("/visits/" + strconv.Itoa(randomId(options.CountVisits)))
+			case 3:
+				query := url.Values{}
+
+				if random.Intn(2) == 0 {
+					query.Set("toDistance", strconv.Itoa(1+random.Intn(99)))
+				}
+
+				if random.Intn(2) == 0 {
+					query.Set("country", synthCountries[random.Intn(len(synthCountries))])
+				}
+
+				item.Tag = "GET:/users/<id>/visits"
+				item.Request = getRequest(withQuery("/users/"+strconv.Itoa(randomId(options.CountUsers))+"/visits", query))
+			default:
+				query := url.Values{}
+
+				if random.Intn(2) == 0 {
+					query.Set("gender", []string{"m", "f"}[random.Intn(2)])
+				}
+
+				if random.Intn(2) == 0 {
+					query.Set("fromAge", strconv.Itoa(random.Intn(60)))
+				}
+
+				item.Tag = "GET:/locations/<id>/avg"
+				item.Request = getRequest(withQuery("/locations/"+strconv.Itoa(randomId(options.CountLocations))+"/avg", query))
+			}
+		}
+
+		ammo = append(ammo, item)
+	}
+
+	return ammo
+}
+
+func withQuery(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+
+	return path + "?" + query.Encode()
+}
+
+func getRequest(uri string) []byte {
+	return []byte("GET " + uri + " HTTP/1.1\r\nHost: travels.com\r\nUser-Agent: hlc2017_go/loadgen\r\nConnection: keep-alive\r\n\r\n")
+}
+
+func postRequest(uri string, body string) []byte {
+	return []byte("POST " + uri + " HTTP/1.1\r\nHost: travels.com\r\nUser-Agent: hlc2017_go/loadgen\r\nConnection: keep-alive\r\n" +
+		"Content-Type: application/json\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body)
+}
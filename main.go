@@ -1,18 +1,103 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/capture"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/exporter"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"github.com/ArtyomNorin/hlc2017_go/server"
 	"log"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
+	"strings"
+	"syscall"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "gen":
+			runGen(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "load":
+			runLoad(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		}
+	}
+
+	runServe(os.Args[1:])
+}
+
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	transportName := flags.String("transport", "evio", "server transport: evio, http or fasthttp")
+	port := flags.Int("port", 80, "port to listen on")
+	dataPath := flags.String("data", "/tmp/hlc/data", "directory with users_*.json, locations_*.json and visits_*.json, or users.csv, locations.csv and visits.csv")
+	optionsPath := flags.String("options", "/tmp/data/options.txt", "path to options.txt")
+	strictnessName := flags.String("strictness", "strict", "bad records of the data: strict fails the start, lenient skips and reports them")
+	recordPath := flags.String("record", "", "write incoming raw requests to this capture file, evio transport only")
+	errorFormatName := flags.String("errors", "text", "error response bodies: text, empty or json")
+	idleTimeout := flags.Duration("idle-timeout", 0, "close keep-alive connections idle for this long, 0 keeps them open")
+	headerTimeout := flags.Duration("header-timeout", server.DefaultHeaderTimeout, "drop connections which take longer to send request headers, 0 disables")
+	maxHeaderSize := flags.Int("max-header-size", server.DefaultMaxHeaderSize, "largest request line with headers in bytes, 0 disables")
+	maxBodySize := flags.Int("max-body-size", server.DefaultMaxBodySize, "largest request body in bytes, 0 disables")
+	compressMinSize := flags.Int("compress-min-size", server.DefaultCompressMinSize, "smallest response body compressed for clients accepting gzip or deflate, 0 disables")
+	maxBufferedBytes := flags.Int("max-buffered-bytes", server.DefaultMaxBufferedBytes, "most unanswered bytes per connection, evio transport only, 0 disables")
+	deletePolicyName := flags.String("delete-policy", "reject", "deleting a user or a location with visits: reject or cascade")
+	softDelete := flags.Bool("soft-delete", false, "keep deleted entities as tombstones, restorable until purged through /admin/tombstones/purge with -admin")
+	admin := flags.Bool("admin", false, "serve the /admin routes for tombstones and exports, they have no authentication")
+	exportPerFile := flags.Int("export-per-file", exporter.DefaultEntitiesPerFile, "count of entities in one file of /admin/export")
+	corsOrigins := flags.String("cors-origins", "", "comma separated origins allowed to call the API from a browser, * allows any")
+	flags.Parse(args)
+
 	fmt.Println(os.Getpid())
 
-	database, err := InitDatabase("/tmp/hlc/data", "/tmp/data/options.txt")
-	//database, err := InitDatabase("/home/artyomnorin/Projects/hlc2017_go/data/full/data", "/home/artyomnorin/Projects/hlc2017_go/data/full/options.txt")
+	transport, err := server.NewTransport(*transportName)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	errorFormat, err := server.ParseErrorFormat(*errorFormatName)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	deletePolicy, err := db.ParseDeletePolicy(*deletePolicyName)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	strictness, err := loader.ParseStrictness(*strictnessName)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	database, report, err := loader.LoadVerified(*dataPath, *optionsPath, strictness)
+	//database, err := loader.Load("/home/artyomnorin/Projects/hlc2017_go/data/full/data", "/home/artyomnorin/Projects/hlc2017_go/data/full/options.txt")
+
+	if report != nil {
+		report.Print(os.Stdout)
+	}
 
 	if err != nil {
 		log.Fatalln(err)
@@ -26,7 +111,55 @@ func main() {
 
 	PrintMemStats()
 
-	NewServer(database).Run(80)
+	httpServer := server.NewServer(database)
+	httpServer.Transport = transport
+	httpServer.ErrorFormat = errorFormat
+	httpServer.IdleTimeout = *idleTimeout
+	httpServer.HeaderTimeout = *headerTimeout
+	httpServer.MaxHeaderSize = *maxHeaderSize
+	httpServer.MaxBodySize = *maxBodySize
+	httpServer.MaxBufferedBytes = *maxBufferedBytes
+	httpServer.CompressMinSize = *compressMinSize
+	httpServer.DeletePolicy = deletePolicy
+	httpServer.SoftDelete = *softDelete
+	httpServer.Admin = *admin
+	httpServer.ExportEntitiesPerFile = *exportPerFile
+
+	if *corsOrigins != "" {
+		httpServer.CORSOrigins = strings.Split(*corsOrigins, ",")
+	}
+
+	var recorder *capture.Writer
+
+	if *recordPath != "" {
+		recorder, err = capture.Create(*recordPath)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		httpServer.Recorder = recorder
+	}
+
+	// Stop serving on a signal so Run returns and the capture gets its tail.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+
+		if err := httpServer.Shutdown(); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	httpServer.Run(*port)
+
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			log.Fatalln(err)
+		}
+	}
 }
 
 func PrintMemStats() {
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/capture"
+	"log"
+	"sort"
+	"time"
+)
+
+func runReplay(args []string) {
+	var options capture.ReplayOptions
+
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	capturePath := flags.String("capture", "", "capture file written by serve -record")
+	flags.StringVar(&options.Addr, "addr", "localhost:80", "address of the server to replay to")
+	flags.BoolVar(&options.RealTime, "realtime", false, "keep the original timing instead of sending as fast as possible")
+	flags.Float64Var(&options.Speed, "speed", 1, "speed-up of the original timing with -realtime")
+	flags.DurationVar(&options.Timeout, "timeout", 2*time.Second, "time to wait for outstanding responses")
+	flags.Parse(args)
+
+	records, err := capture.ReadFile(*capturePath)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	report := capture.Replay(records, options)
+
+	fmt.Printf("%d connections, %d records sent, %d responses, %d errors in %s\n",
+		report.Connections, report.Records, report.Responses, report.Errors, report.Elapsed.Round(time.Millisecond))
+
+	statusCodes := make([]int, 0, len(report.StatusCodes))
+
+	for statusCode := range report.StatusCodes {
+		statusCodes = append(statusCodes, statusCode)
+	}
+
+	sort.Ints(statusCodes)
+
+	for _, statusCode := range statusCodes {
+		fmt.Printf("%d: %d\n", statusCode, report.StatusCodes[statusCode])
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"bytes"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/buger/jsonparser"
+	"strconv"
+)
+
+var errUnknownOperation = fieldError("op", "must be create or update")
+var errUnknownEntity = fieldError("entity", "must be user, location or visit")
+var errMissingBody = fieldError("body", "must be a JSON object")
+
+// applyBatch runs the newline delimited operations of POST /batch in order,
+// each line is answered with the status its single entity route would give.
+// The batch itself gets 200 even when lines fail. A line which cannot be
+// parsed fails an atomic batch before anything runs.
+func (s *Server) applyBatch(body []byte, isAtomic bool, response *Response) {
+	var lines []int
+	var operations []db.Operation
+	var errs []error
+
+	// applied maps each line to its operation, -1 for lines which failed to parse.
+	var applied []int
+	isParsed := true
+
+	for lineNumber := 1; len(body) != 0; lineNumber++ {
+		line := body
+
+		if index := bytes.IndexByte(body, '\n'); index != -1 {
+			line, body = body[:index], body[index+1:]
+		} else {
+			body = nil
+		}
+
+		line = bytes.TrimSpace(line)
+
+		if len(line) == 0 {
+			continue
+		}
+
+		var operation db.Operation
+
+		err := parseBatchLine(line, &operation)
+
+		lines = append(lines, lineNumber)
+		errs = append(errs, err)
+
+		if err != nil {
+			applied = append(applied, -1)
+			isParsed = false
+			continue
+		}
+
+		applied = append(applied, len(operations))
+		operations = append(operations, operation)
+	}
+
+	if isAtomic && !isParsed {
+		for index, err := range errs {
+			if err == nil {
+				errs[index] = db.ErrNotApplied
+			}
+		}
+	} else {
+		results := s.DataBase.Apply(operations, isAtomic, nil)
+
+		for index, operationIndex := range applied {
+			if operationIndex != -1 {
+				errs[index] = results[operationIndex]
+			}
+		}
+	}
+
+	response.WriteBatchResults(lines, errs)
+}
+
+// parseBatchLine decodes one operation of POST /batch:
+// {"op": "create" | "update", "entity": "user" | "location" | "visit", "id": 1, "body": {...}}.
+// The body is the one of the single entity route, id is only read for updates.
+func parseBatchLine(line []byte, operation *db.Operation) error {
+	var op, body []byte
+
+	err := jsonparser.ObjectEach(line, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		switch string(key) {
+		case "op":
+			op = value
+		case "entity":
+			operation.Entity = string(value)
+		case "id":
+			return parseIdField(key, value, dataType, &operation.Id)
+		case "body":
+			if dataType != jsonparser.Object {
+				return errMissingBody
+			}
+
+			body = value
+		}
+
+		return nil
+	})
+
+	if err = bodyError(err); err != nil {
+		return err
+	}
+
+	switch string(op) {
+	case "create":
+		operation.IsCreate = true
+	case "update":
+	default:
+		return errUnknownOperation
+	}
+
+	if body == nil {
+		return errMissingBody
+	}
+
+	var id int
+
+	switch operation.Entity {
+	case db.UserEntity:
+		operation.User = new(db.UserFields)
+		id, err = parseUserBody(body, operation.User)
+	case db.LocationEntity:
+		operation.Location = new(db.LocationFields)
+		id, err = parseLocationBody(body, operation.Location)
+	case db.VisitEntity:
+		operation.Visit = new(db.VisitFields)
+		id, err = parseVisitBody(body, operation.Visit)
+	default:
+		return errUnknownEntity
+	}
+
+	if operation.IsCreate {
+		operation.Id = id
+	}
+
+	if err == nil && !operation.IsCreate && operation.Id == 0 {
+		return fieldError("id", "must be set for updates")
+	}
+
+	return err
+}
+
+// parseTransaction decodes the body of POST /transactions:
+// {"create": {"users": [...], "locations": [...], "visits": [...]}, "update": {...}}.
+// Items are the bodies of the single entity routes, updates name their id.
+// paths tells where each operation came from, like "create.visits[2]".
+func parseTransaction(body []byte) (operations []db.Operation, paths []string, err error) {
+	err = jsonparser.ObjectEach(body, func(group []byte, groupValue []byte, dataType jsonparser.ValueType, offset int) error {
+		isCreate := string(group) == "create"
+
+		if !isCreate && string(group) != "update" {
+			return nil
+		}
+
+		if dataType != jsonparser.Object {
+			return fieldError(string(group), "must be a JSON object")
+		}
+
+		return jsonparser.ObjectEach(groupValue, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+			var entity string
+
+			switch string(key) {
+			case "users":
+				entity = db.UserEntity
+			case "locations":
+				entity = db.LocationEntity
+			case "visits":
+				entity = db.VisitEntity
+			default:
+				return nil
+			}
+
+			prefix := string(group) + "." + string(key)
+
+			if dataType != jsonparser.Array {
+				return fieldError(prefix, "must be an array")
+			}
+
+			var itemErr error
+			index := 0
+
+			_, err := jsonparser.ArrayEach(value, func(item []byte, dataType jsonparser.ValueType, offset int, err error) {
+				path := prefix + "[" + strconv.Itoa(index) + "]"
+				index++
+
+				if itemErr != nil {
+					return
+				}
+
+				if dataType != jsonparser.Object {
+					itemErr = fieldError(path, "must be a JSON object")
+					return
+				}
+
+				operation := db.Operation{Entity: entity, IsCreate: isCreate}
+
+				if itemErr = parseTransactionItem(item, &operation); itemErr != nil {
+					itemErr = prefixError(path, itemErr)
+					return
+				}
+
+				operations = append(operations, operation)
+				paths = append(paths, path)
+			})
+
+			if itemErr != nil {
+				return itemErr
+			}
+
+			return err
+		})
+	})
+
+	return operations, paths, bodyError(err)
+}
+
+func parseTransactionItem(item []byte, operation *db.Operation) (err error) {
+	switch operation.Entity {
+	case db.UserEntity:
+		operation.User = new(db.UserFields)
+		operation.Id, err = parseUserBody(item, operation.User)
+	case db.LocationEntity:
+		operation.Location = new(db.LocationFields)
+		operation.Id, err = parseLocationBody(item, operation.Location)
+	case db.VisitEntity:
+		operation.Visit = new(db.VisitFields)
+		operation.Id, err = parseVisitBody(item, operation.Visit)
+	}
+
+	if err == nil && !operation.IsCreate && operation.Id == 0 {
+		return fieldError("id", "must be set for updates")
+	}
+
+	return err
+}
+
+// prefixError puts the path of a transaction item in front of the field at fault.
+func prefixError(path string, err error) error {
+	requestError, isRequestError := err.(*RequestError)
+
+	if !isRequestError {
+		return &RequestError{Field: path, Message: err.Error()}
+	}
+
+	if requestError.Field == "" {
+		return &RequestError{Field: path, Message: requestError.Message}
+	}
+
+	return &RequestError{Field: path + "." + requestError.Field, Message: requestError.Message}
+}
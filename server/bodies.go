@@ -0,0 +1,127 @@
+package server
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/buger/jsonparser"
+)
+
+func parseStringField(key []byte, value []byte, dataType jsonparser.ValueType, field **string) error {
+	if dataType != jsonparser.String {
+		return fieldError(string(key), "must be a string")
+	}
+
+	parsed, err := jsonparser.ParseString(value)
+
+	if err != nil {
+		return fieldError(string(key), "is not a valid string")
+	}
+
+	*field = &parsed
+
+	return nil
+}
+
+func parseIntField(key []byte, value []byte, dataType jsonparser.ValueType, field **int) error {
+	if dataType != jsonparser.Number {
+		return fieldError(string(key), "must be an integer")
+	}
+
+	parsed, err := jsonparser.ParseInt(value)
+
+	if err != nil {
+		return fieldError(string(key), "must be an integer")
+	}
+
+	parsedInt := int(parsed)
+	*field = &parsedInt
+
+	return nil
+}
+
+func parseIdField(key []byte, value []byte, dataType jsonparser.ValueType, id *int) error {
+	var parsed *int
+
+	if err := parseIntField(key, value, dataType, &parsed); err != nil {
+		return err
+	}
+
+	*id = *parsed
+
+	return nil
+}
+
+// parseUserBody decodes the body of POST /users/new and POST /users/<id>.
+// The id is only read for creates, null values are rejected.
+func parseUserBody(body []byte, fields *db.UserFields) (id int, err error) {
+	err = jsonparser.ObjectEach(body, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		switch string(key) {
+		case "id":
+			return parseIdField(key, value, dataType, &id)
+		case "email":
+			return parseStringField(key, value, dataType, &fields.Email)
+		case "first_name":
+			return parseStringField(key, value, dataType, &fields.FirstName)
+		case "last_name":
+			return parseStringField(key, value, dataType, &fields.LastName)
+		case "gender":
+			return parseStringField(key, value, dataType, &fields.Gender)
+		case "birth_date":
+			return parseIntField(key, value, dataType, &fields.BirthDate)
+		}
+
+		return nil
+	})
+
+	return id, bodyError(err)
+}
+
+func parseLocationBody(body []byte, fields *db.LocationFields) (id int, err error) {
+	err = jsonparser.ObjectEach(body, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		switch string(key) {
+		case "id":
+			return parseIdField(key, value, dataType, &id)
+		case "place":
+			return parseStringField(key, value, dataType, &fields.Place)
+		case "country":
+			return parseStringField(key, value, dataType, &fields.Country)
+		case "city":
+			return parseStringField(key, value, dataType, &fields.City)
+		case "distance":
+			return parseIntField(key, value, dataType, &fields.Distance)
+		}
+
+		return nil
+	})
+
+	return id, bodyError(err)
+}
+
+func parseVisitBody(body []byte, fields *db.VisitFields) (id int, err error) {
+	err = jsonparser.ObjectEach(body, func(key []byte, value []byte, dataType jsonparser.ValueType, offset int) error {
+		switch string(key) {
+		case "id":
+			return parseIdField(key, value, dataType, &id)
+		case "location":
+			return parseIntField(key, value, dataType, &fields.Location)
+		case "user":
+			return parseIntField(key, value, dataType, &fields.User)
+		case "visited_at":
+			return parseIntField(key, value, dataType, &fields.VisitedAt)
+		case "mark":
+			return parseIntField(key, value, dataType, &fields.Mark)
+		}
+
+		return nil
+	})
+
+	return id, bodyError(err)
+}
+
+// bodyError keeps the field at fault, jsonparser errors mean the body as a whole is malformed.
+func bodyError(err error) error {
+	if _, isRequestError := err.(*RequestError); err == nil || isRequestError {
+		return err
+	}
+
+	return errMalformedBody
+}
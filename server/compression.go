@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"sync"
+)
+
+const gzipEncoding = "gzip"
+const deflateEncoding = "deflate"
+
+var acceptEncodingHeader = []byte("Accept-Encoding")
+
+var gzipToken = []byte(gzipEncoding)
+var deflateToken = []byte(deflateEncoding)
+var anyToken = []byte("*")
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		writer, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
+		return writer
+	},
+}
+
+var zlibWriterPool = sync.Pool{
+	New: func() interface{} {
+		writer, _ := zlib.NewWriterLevel(nil, zlib.BestSpeed)
+		return writer
+	},
+}
+
+// appendWriter lets the compressors write straight into a pooled response buffer.
+type appendWriter struct {
+	out []byte
+}
+
+func (w *appendWriter) Write(data []byte) (int, error) {
+	w.out = append(w.out, data...)
+	return len(data), nil
+}
+
+// compress encodes a body of at least CompressMinSize bytes with the encoding
+// the client prefers, the compressed body swaps buffers with the plain one.
+func (s *Server) compress(request *Request, response *Response) {
+	if s.CompressMinSize <= 0 || len(response.Body) < s.CompressMinSize {
+		return
+	}
+
+	// A zip is compressed already.
+	if response.MediaType == zipContentType {
+		return
+	}
+
+	encoding := negotiateEncoding(request.AcceptEncoding)
+
+	if encoding == "" {
+		return
+	}
+
+	writer := appendWriter{out: response.encoded[:0]}
+
+	if encoding == gzipEncoding {
+		compressor := gzipWriterPool.Get().(*gzip.Writer)
+		compressor.Reset(&writer)
+		compressor.Write(response.Body)
+		compressor.Close()
+		gzipWriterPool.Put(compressor)
+	} else {
+		compressor := zlibWriterPool.Get().(*zlib.Writer)
+		compressor.Reset(&writer)
+		compressor.Write(response.Body)
+		compressor.Close()
+		zlibWriterPool.Put(compressor)
+	}
+
+	response.Body, response.encoded = writer.out, response.Body[:0]
+	response.ContentEncoding = encoding
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding value by
+// quality, gzip on a tie. It is empty when the body has to stay plain.
+func negotiateEncoding(acceptEncoding []byte) string {
+	// -1 is a coding the client did not name, it gets the quality of "*".
+	gzipQuality, deflateQuality, anyQuality := -1, -1, 0
+
+	for len(acceptEncoding) > 0 {
+		item := acceptEncoding
+		acceptEncoding = nil
+
+		if index := bytes.IndexByte(item, ','); index != -1 {
+			item, acceptEncoding = item[:index], item[index+1:]
+		}
+
+		coding, quality := item, 1000
+
+		if index := bytes.IndexByte(item, ';'); index != -1 {
+			coding, quality = item[:index], parseQuality(item[index+1:])
+		}
+
+		coding = bytes.TrimSpace(coding)
+
+		if bytes.EqualFold(coding, gzipToken) {
+			gzipQuality = quality
+		} else if bytes.EqualFold(coding, deflateToken) {
+			deflateQuality = quality
+		} else if bytes.Equal(coding, anyToken) {
+			anyQuality = quality
+		}
+	}
+
+	if gzipQuality == -1 {
+		gzipQuality = anyQuality
+	}
+
+	if deflateQuality == -1 {
+		deflateQuality = anyQuality
+	}
+
+	if gzipQuality == 0 && deflateQuality == 0 {
+		return ""
+	}
+
+	if gzipQuality >= deflateQuality {
+		return gzipEncoding
+	}
+
+	return deflateEncoding
+}
+
+// parseQuality reads the q parameter in thousandths, anything unreadable counts as 0.
+func parseQuality(params []byte) int {
+	params = bytes.TrimSpace(params)
+
+	if len(params) < 3 || (params[0] != 'q' && params[0] != 'Q') || params[1] != '=' {
+		return 0
+	}
+
+	value := params[2:]
+
+	if value[0] == '1' {
+		return 1000
+	}
+
+	if value[0] != '0' {
+		return 0
+	}
+
+	quality := 0
+
+	if len(value) > 1 && value[1] == '.' {
+		for index, scale := 2, 100; index < len(value) && index < 5; index, scale = index+1, scale/10 {
+			if value[index] < '0' || value[index] > '9' {
+				return 0
+			}
+
+			quality += int(value[index]-'0') * scale
+		}
+	}
+
+	return quality
+}
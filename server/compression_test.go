@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"deflate", "deflate"},
+		{" GZIP ", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip;q=0, deflate;q=0.001", "deflate"},
+		{"gzip;q=0.000, deflate;q=0", ""},
+		{"*", "gzip"},
+		{"gzip;q=0, *", "deflate"},
+		{"*;q=0", ""},
+		{"br", ""},
+		{"gzip;q=x", ""},
+	}
+
+	for _, test := range tests {
+		if encoding := negotiateEncoding([]byte(test.acceptEncoding)); encoding != test.expected {
+			t.Errorf("%q: encoding %q, expected %q", test.acceptEncoding, encoding, test.expected)
+		}
+	}
+}
+
+func TestServer_compress(t *testing.T) {
+	s := &Server{CompressMinSize: 16}
+	body := strings.Repeat(`{"mark":4,"visited_at":1000000000,"place":"Park"}`, 10)
+
+	tests := []struct {
+		body           string
+		acceptEncoding string
+		expected       string
+	}{
+		{body, "gzip, deflate", "gzip"},
+		{body, "deflate", "deflate"},
+		{body, "", ""},
+		{`{}`, "gzip", ""},
+	}
+
+	response := new(Response)
+
+	// The same response is reused to check that swapped buffers stay intact.
+	for _, test := range tests {
+		response.Reset()
+		response.Body = append(response.Body, test.body...)
+
+		s.compress(&Request{AcceptEncoding: []byte(test.acceptEncoding)}, response)
+
+		if response.ContentEncoding != test.expected {
+			t.Fatalf("%q: encoding %q, expected %q", test.acceptEncoding, response.ContentEncoding, test.expected)
+		}
+
+		if decoded := decodeBody(t, response.ContentEncoding, response.Body); decoded != test.body {
+			t.Fatalf("%q: decoded body %s", test.acceptEncoding, decoded)
+		}
+	}
+}
+
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var reader io.Reader = bytes.NewReader(body)
+	var err error
+
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(reader)
+	case "deflate":
+		reader, err = zlib.NewReader(reader)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(decoded)
+}
@@ -0,0 +1,25 @@
+package server
+
+// corsAllowedHeaders are the request headers a browser may send cross origin,
+// corsExposedHeaders the response headers its scripts may read.
+const corsAllowedHeaders = "Content-Type, If-Match, If-None-Match"
+const corsExposedHeaders = "ETag"
+const corsMaxAge = "600"
+
+var originHeader = []byte("Origin")
+
+// allowOrigin returns the Access-Control-Allow-Origin value for the Origin
+// of a request, empty when the origin is not in CORSOrigins.
+func (s *Server) allowOrigin(origin []byte) string {
+	if len(origin) == 0 {
+		return ""
+	}
+
+	for _, allowed := range s.CORSOrigins {
+		if allowed == "*" || allowed == string(origin) {
+			return allowed
+		}
+	}
+
+	return ""
+}
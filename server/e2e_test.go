@@ -0,0 +1,1094 @@
+package server
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/exporter"
+	"github.com/ArtyomNorin/hlc2017_go/loader"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestServer_Get(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+
+			user, _ := ts.DataBase.GetUser(1)
+			location, _ := ts.DataBase.GetLocation(2)
+			visit, _ := ts.DataBase.GetVisit(3)
+			visits, _ := ts.DataBase.GetVisitedPlaces(1, new(db.VisitedPlacesFilter), nil)
+			avgMark, _ := ts.DataBase.GetAvgMark(2, &db.AvgMarkFilter{Gender: "f"})
+
+			expected := new(Response)
+
+			expected.WriteUser(user)
+			ts.Do(t, getRequest("/users/1")).Expect(t, 200, expected.Body)
+
+			expected.WriteLocation(location)
+			ts.Do(t, getRequest("/locations/2")).Expect(t, 200, expected.Body)
+
+			expected.WriteVisit(visit)
+			ts.Do(t, getRequest("/visits/3")).Expect(t, 200, expected.Body)
+
+			expected.WriteVisitedPlaces(visits)
+			ts.Do(t, getRequest("/users/1/visits")).Expect(t, 200, expected.Body)
+
+			expected.WriteAvgMark(avgMark)
+			ts.Do(t, getRequest("/locations/2/avg?gender=f")).Expect(t, 200, expected.Body)
+
+			for _, uri := range []string{"/users/100000", "/users/0", "/visits/100000", "/locations/100000/avg", "/users/abc", "/unknown"} {
+				ts.Do(t, getRequest(uri)).Expect(t, 404, nil)
+			}
+
+			for _, uri := range []string{"/users/1/visits?toDistance=abc", "/users/1/visits?fromDate=", "/locations/2/avg?gender=x"} {
+				ts.Do(t, getRequest(uri)).Expect(t, 400, nil)
+			}
+		})
+	}
+}
+
+func TestServer_Compression(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.CompressMinSize = 64 })
+
+			visits, _ := ts.DataBase.GetVisitedPlaces(1, new(db.VisitedPlacesFilter), nil)
+			plain := ts.Do(t, getRequest("/users/1/visits"))
+
+			if len(visits) == 0 || plain.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("expected a plain body with visits, got %q", plain.Header.Get("Content-Encoding"))
+			}
+
+			for _, encoding := range []string{"gzip", "deflate"} {
+				request := "GET /users/1/visits HTTP/1.1\r\nHost: travels.com\r\nAccept-Encoding: " + encoding + "\r\n\r\n"
+				response := ts.Do(t, request)
+
+				response.Expect(t, 200, nil)
+
+				if response.Header.Get("Content-Encoding") != encoding || response.Header.Get("Vary") != "Accept-Encoding" {
+					t.Fatalf("%s: headers %v", encoding, response.Header)
+				}
+
+				if decoded := decodeBody(t, encoding, response.Body); decoded != string(plain.Body) {
+					t.Fatalf("%s: decoded body %s, expected %s", encoding, decoded, plain.Body)
+				}
+			}
+
+			// Small bodies are not worth compressing.
+			response := ts.Do(t, "GET /users/100000 HTTP/1.1\r\nHost: travels.com\r\nAccept-Encoding: gzip\r\n\r\n")
+
+			if response.Header.Get("Content-Encoding") != "" {
+				t.Fatalf("small body sent with %q", response.Header.Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestServer_ConditionalGet(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			visits, _ := ts.DataBase.GetVisitedPlaces(1, new(db.VisitedPlacesFilter), nil)
+
+			if len(visits) == 0 {
+				t.Fatal("user 1 has no visits")
+			}
+
+			for _, uri := range []string{"/users/1", "/visits/1", "/locations/1", "/users/1/visits", "/locations/1/avg?gender=m"} {
+				c.Send(t, getRequest(uri))
+				response := c.Read(t)
+				etag := response.Header.Get("ETag")
+
+				response.Expect(t, 200, nil)
+
+				if etag == "" {
+					t.Fatalf("%s: no ETag", uri)
+				}
+
+				c.Send(t, conditionalRequest(uri, etag))
+
+				if response := c.Read(t); response.StatusCode != 304 || len(response.Body) != 0 || response.Header.Get("ETag") != etag {
+					t.Fatalf("%s: status %d, ETag %q, body %q for a matching tag", uri, response.StatusCode, response.Header.Get("ETag"), response.Body)
+				}
+
+				c.Send(t, conditionalRequest(uri, `"1"`))
+				c.Read(t).Expect(t, 200, nil)
+			}
+
+			c.Send(t, getRequest("/users/1/visits"))
+			etag := c.Read(t).Header.Get("ETag")
+
+			// Renaming a visited place changes the visited places of the user.
+			c.Send(t, postRequest("/locations/"+strconv.Itoa(int(visits[0].Location.Id)), `{"place": "Renamed"}`))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, conditionalRequest("/users/1/visits", etag))
+			response := c.Read(t)
+
+			response.Expect(t, 200, nil)
+
+			if response.Header.Get("ETag") == etag || !strings.Contains(string(response.Body), "Renamed") {
+				t.Fatalf("stale visited places %s with ETag %q", response.Body, response.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestServer_IfMatch(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.ErrorFormat = JSONErrors })
+			c := ts.Dial(t)
+
+			for _, uri := range []string{"/users/1", "/locations/1", "/visits/1"} {
+				c.Send(t, getRequest(uri))
+				etag := c.Read(t).Header.Get("ETag")
+				body := `{"distance": 1}`
+
+				switch uri {
+				case "/users/1":
+					body = `{"first_name": "Edited"}`
+				case "/visits/1":
+					body = `{"mark": 1}`
+				}
+
+				// The second client still holds the version the first one replaced.
+				for _, test := range []struct {
+					ifMatch    string
+					statusCode int
+					body       string
+				}{
+					{`W/` + etag, 412, `{"error": "entity version does not match"}`},
+					{etag, 200, `{}`},
+					{etag, 412, `{"error": "entity version does not match"}`},
+					{`*`, 200, `{}`},
+				} {
+					c.Send(t, strings.Replace(postRequest(uri, body), "\r\n\r\n", "\r\nIf-Match: "+test.ifMatch+"\r\n\r\n", 1))
+					c.Read(t).Expect(t, test.statusCode, []byte(test.body))
+				}
+			}
+
+			user, _ := ts.DataBase.GetUser(1)
+
+			if user.FirstName != "Edited" {
+				t.Fatalf("unexpected first name %s", user.FirstName)
+			}
+		})
+	}
+}
+
+func TestServer_Delete(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.ErrorFormat = JSONErrors })
+			c := ts.Dial(t)
+
+			visit, _ := ts.DataBase.GetVisit(1)
+			userId := strconv.Itoa(int(visit.User.Id))
+
+			c.Send(t, deleteRequest("/users/"+userId))
+			c.Read(t).Expect(t, 409, []byte(`{"error": "entity still has visits"}`))
+
+			c.Send(t, getRequest("/users/"+userId+"/visits"))
+			before := c.Read(t)
+
+			c.Send(t, deleteRequest("/visits/1"))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, getRequest("/visits/1"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, deleteRequest("/visits/1"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, getRequest("/users/"+userId+"/visits"))
+
+			if after := c.Read(t); len(after.Body) >= len(before.Body) || after.Header.Get("ETag") == before.Header.Get("ETag") {
+				t.Fatalf("deleted visit is still listed: %s", after.Body)
+			}
+
+			ts = startTestServer(t, transportName, func(s *Server) { s.DeletePolicy = db.CascadeDelete })
+			c = ts.Dial(t)
+
+			location, _ := ts.DataBase.GetLocation(1)
+			visitIds := visitIds(location.VisitsIndex)
+
+			c.Send(t, deleteRequest("/locations/1"))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			for _, id := range visitIds {
+				c.Send(t, getRequest("/visits/"+strconv.Itoa(id)))
+				c.Read(t).Expect(t, 404, nil)
+			}
+
+			c.Send(t, getRequest("/locations/1/avg"))
+			c.Read(t).Expect(t, 404, nil)
+		})
+	}
+}
+
+func TestServer_SoftDelete(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) {
+				s.ErrorFormat = JSONErrors
+				s.SoftDelete = true
+				s.DeletePolicy = db.CascadeDelete
+				s.Admin = true
+			})
+			c := ts.Dial(t)
+
+			visit, _ := ts.DataBase.GetVisit(1)
+			userId := strconv.Itoa(int(visit.User.Id))
+
+			c.Send(t, getRequest("/users/"+userId+"/visits"))
+			before := c.Read(t)
+
+			c.Send(t, deleteRequest("/users/"+userId))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, getRequest("/users/"+userId+"/visits"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, getRequest("/visits/1"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, postRequest("/visits/1/restore", ""))
+			c.Read(t).Expect(t, 409, []byte(`{"error": "visit user or location is deleted"}`))
+
+			c.Send(t, getRequest("/admin/tombstones"))
+
+			if listed := c.Read(t); listed.StatusCode != 200 || !strings.Contains(string(listed.Body), `{"entity":"user","id":`+userId+`,"deleted_at":`) {
+				t.Fatalf("deleted user is not listed: %d %s", listed.StatusCode, listed.Body)
+			}
+
+			c.Send(t, postRequest("/users/"+userId+"/restore", ""))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, getRequest("/users/"+userId+"/visits"))
+
+			if after := c.Read(t); after.StatusCode != 200 || string(after.Body) != string(before.Body) {
+				t.Fatalf("visits were not restored with the user: %s", after.Body)
+			}
+
+			c.Send(t, postRequest("/users/"+userId+"/restore", ""))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, deleteRequest("/visits/1"))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, postRequest("/admin/tombstones/purge?before=abc", ""))
+			c.Read(t).Expect(t, 400, []byte(`{"error": "must be an integer", "field": "before"}`))
+
+			c.Send(t, postRequest("/admin/tombstones/purge", ""))
+			c.Read(t).Expect(t, 200, []byte(`{"purged": 1}`))
+
+			c.Send(t, getRequest("/admin/tombstones"))
+			c.Read(t).Expect(t, 200, []byte(`{"tombstones": []}`))
+
+			c.Send(t, postRequest("/visits/1/restore", ""))
+			c.Read(t).Expect(t, 404, nil)
+		})
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			batch := `{"op": "create", "entity": "user", "body": {"id": 100001, "email": "batch@example.com", "first_name": "Batch", "last_name": "User", "gender": "f", "birth_date": 0}}
+{"op": "create", "entity": "visit", "body": {"id": 100001, "user": 100001, "location": 1, "visited_at": 1000000000, "mark": 5}}
+
+{"op": "update", "entity": "user", "id": 100001, "body": {"gender": "x"}}
+{"op": "remove", "entity": "user", "id": 100001, "body": {}}
+{"op": "update", "entity": "user", "body": {"gender": "m"}}
+`
+
+			c.Send(t, postRequest("/batch", batch))
+			c.Read(t).Expect(t, 200, []byte(`{"results": [{"line": 1, "status": 200},{"line": 2, "status": 200},`+
+				`{"line": 4, "status": 400, "error": "invalid entity fields"},{"line": 5, "status": 400, "error": "must be create or update", "field": "op"},`+
+				`{"line": 6, "status": 400, "error": "must be set for updates", "field": "id"}]}`))
+
+			location, _ := ts.DataBase.GetLocation(1)
+
+			c.Send(t, getRequest("/users/100001/visits"))
+			c.Read(t).Expect(t, 200, []byte(`{"visits": [{"mark":5,"visited_at":1000000000,"place":"`+location.Place+`"}]}`))
+
+			atomic := `{"op": "update", "entity": "user", "id": 100001, "body": {"first_name": "Renamed"}}
+{"op": "create", "entity": "visit", "body": {"id": 100002, "user": 100001, "location": 999999, "visited_at": 0, "mark": 5}}
+{"op": "update", "entity": "user", "id": 100001, "body": {"last_name": "Renamed"}}`
+
+			c.Send(t, postRequest("/batch?atomic=true", atomic))
+			c.Read(t).Expect(t, 200, []byte(`{"results": [{"line": 1, "status": 409, "error": "operation rolled back"},`+
+				`{"line": 2, "status": 400, "error": "invalid entity fields"},{"line": 3, "status": 409, "error": "operation not applied"}]}`))
+
+			if user, _ := ts.DataBase.GetUser(100001); user.FirstName != "Batch" {
+				t.Fatalf("failed atomic batch was not rolled back: %s", user.FirstName)
+			}
+
+			c.Send(t, postRequest("/batch?atomic=yes", atomic))
+			c.Read(t).Expect(t, 400, nil)
+		})
+	}
+}
+
+func TestServer_Transaction(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.ErrorFormat = JSONErrors })
+			c := ts.Dial(t)
+
+			transaction := `{"create": {
+				"visits": [{"id": 100001, "user": 100001, "location": 100001, "visited_at": 1000000000, "mark": 5}],
+				"users": [{"id": 100001, "email": "tx@example.com", "first_name": "Tx", "last_name": "User", "gender": "f", "birth_date": 0}],
+				"locations": [{"id": 100001, "place": "Pier", "country": "Chile", "city": "Valparaiso", "distance": %s}]
+			}, "update": {"users": [{"id": 1, "first_name": "Renamed"}]}}`
+
+			user, _ := ts.DataBase.GetUser(1)
+			version, countUsers := user.Version, len(ts.DataBase.Users)
+
+			c.Send(t, postRequest("/transactions", fmt.Sprintf(transaction, `-1`)))
+			c.Read(t).Expect(t, 400, []byte(`{"error": "invalid entity fields", "field": "create.locations[0]"}`))
+
+			if ts.DataBase.IsUserExist(100001) || len(ts.DataBase.Users) != countUsers {
+				t.Fatal("failed transaction left a user behind")
+			}
+
+			if user.Version != version {
+				t.Fatalf("failed transaction bumped the version from %d to %d", version, user.Version)
+			}
+
+			c.Send(t, postRequest("/transactions", fmt.Sprintf(transaction, `"far"`)))
+			c.Read(t).Expect(t, 400, []byte(`{"error": "must be an integer", "field": "create.locations[0].distance"}`))
+
+			c.Send(t, postRequest("/transactions", fmt.Sprintf(transaction, `3`)))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, getRequest("/users/100001/visits"))
+			c.Read(t).Expect(t, 200, []byte(`{"visits": [{"mark":5,"visited_at":1000000000,"place":"Pier"}]}`))
+
+			c.Send(t, postRequest("/transactions", `{"update": {"users": [{"id": 100002, "first_name": "Later"}]},
+				"create": {"users": [{"id": 100002, "email": "tx2@example.com", "first_name": "Tx", "last_name": "User", "gender": "m", "birth_date": 0}]}}`))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			if user, _ := ts.DataBase.GetUser(100002); user == nil || user.FirstName != "Later" {
+				t.Fatal("update group before the create group was not applied after it")
+			}
+
+			c.Send(t, postRequest("/transactions", `{"update": {"visits": [{"mark": 1}]}}`))
+			c.Read(t).Expect(t, 400, []byte(`{"error": "must be set for updates", "field": "update.visits[0].id"}`))
+		})
+	}
+}
+
+func TestServer_Export(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) {
+				s.ExportEntitiesPerFile = 20
+				s.Admin = true
+			})
+			c := ts.Dial(t)
+
+			c.Send(t, getRequest("/admin/export"))
+			c.Read(t).Expect(t, 200, []byte(`{"files": ["users_1.json","users_2.json","users_3.json","locations_1.json","locations_2.json","locations_3.json",`+
+				`"visits_1.json"`+visitFiles(2, 25)+`]}`))
+
+			c.Send(t, getRequest("/admin/export/locations_2.json"))
+			c.Read(t).Expect(t, 200, exporter.AppendFile(nil, ts.DataBase, exporter.File{Entity: db.LocationEntity, Number: 2}, 20))
+
+			c.Send(t, getRequest("/admin/export/users_4.json"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, getRequest("/admin/export/options.txt"))
+
+			if options := c.Read(t); options.Header.Get("Content-Type") != "text/plain" || string(options.Body) != string(exporter.AppendOptions(nil, ts.DataBase)) {
+				t.Fatalf("unexpected options %q %q", options.Header.Get("Content-Type"), options.Body)
+			}
+
+			// Streamed exports have no Content-Length, evio closes the connection after them.
+			archive := ts.Do(t, getRequest("/admin/export/data.zip"))
+
+			if archive.Header.Get("Content-Type") != "application/zip" || archive.Header.Get("Content-Length") != "" {
+				t.Fatalf("unexpected data.zip headers %v", archive.Header)
+			}
+
+			if entries, err := zip.NewReader(bytes.NewReader(archive.Body), int64(len(archive.Body))); err != nil || len(entries.File) != 31 || entries.File[30].Name != "visits_25.json" {
+				t.Fatalf("unexpected data.zip entries: %v", err)
+			}
+
+			if visits := ts.Do(t, getRequest("/admin/export/visits.csv")); visits.Header.Get("Content-Type") != "text/csv; charset=utf-8" || !strings.HasPrefix(string(visits.Body), "id,location,user,visited_at,mark\n1,") {
+				t.Fatalf("unexpected visits.csv %q", visits.Body)
+			}
+
+			dir := t.TempDir()
+
+			if err := exporter.DownloadCSV(ts.Addr, filepath.Join(dir, "csv"), filepath.Join(dir, "options.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := loader.Load(filepath.Join(dir, "csv"), filepath.Join(dir, "options.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := exporter.Download(ts.Addr, filepath.Join(dir, "data"), filepath.Join(dir, "options.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			exported, err := loader.Load(filepath.Join(dir, "data"), filepath.Join(dir, "options.txt"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if visit, _ := exported.GetVisit(500); visit.Mark != ts.DataBase.Visits[499].Mark {
+				t.Fatal("downloaded export differs from the served dataset")
+			}
+
+			c = startTestServer(t, transportName).Dial(t)
+
+			for _, request := range []string{getRequest("/admin/export"), getRequest("/admin/export/data.zip"), postRequest("/admin/tombstones/purge", "")} {
+				c.Send(t, request)
+				c.Read(t).Expect(t, 404, nil)
+			}
+		})
+	}
+}
+
+func visitFiles(from int, to int) string {
+	var files string
+
+	for number := from; number <= to; number++ {
+		files += `,"visits_` + strconv.Itoa(number) + `.json"`
+	}
+
+	return files
+}
+
+func deleteRequest(uri string) string {
+	return "DELETE " + uri + " HTTP/1.1\r\nHost: travels.com\r\n\r\n"
+}
+
+func visitIds(visits []*db.Visit) []int {
+	ids := make([]int, 0, len(visits))
+
+	for _, visit := range visits {
+		ids = append(ids, int(visit.Id))
+	}
+
+	return ids
+}
+
+func conditionalRequest(uri string, etag string) string {
+	return "GET " + uri + " HTTP/1.1\r\nHost: travels.com\r\nIf-None-Match: " + etag + "\r\n\r\n"
+}
+
+func TestServer_Errors(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.ErrorFormat = JSONErrors })
+
+			tests := []struct {
+				request    string
+				statusCode int
+				body       string
+			}{
+				{getRequest("/users/100000"), 404, `{"error": "Not Found"}`},
+				{getRequest("/users/1/visits?toDistance=abc"), 400, `{"error": "must be an integer", "field": "toDistance"}`},
+				{getRequest("/locations/1/avg?gender=x"), 400, `{"error": "must be m or f", "field": "gender"}`},
+				{postRequest("/users/1", `{"email": null}`), 400, `{"error": "must be a string", "field": "email"}`},
+				{postRequest("/users/1", `{"email": "a@example.com",`), 400, `{"error": "body is not a JSON object"}`},
+				{postRequest("/users/new", `{"id": 1}`), 400, `{"error": "invalid entity fields"}`},
+				{postRequest("/visits/1", `{"mark": 6}`), 400, `{"error": "invalid entity fields"}`},
+				{"PUT /users/1 HTTP/1.1\r\nHost: travels.com\r\nContent-Length: 0\r\n\r\n", 405, `{"error": "Method Not Allowed"}`},
+			}
+
+			for _, test := range tests {
+				response := ts.Do(t, test.request)
+				response.Expect(t, test.statusCode, []byte(test.body))
+
+				if test.statusCode == 405 && response.Header.Get("Allow") != entityMethods {
+					t.Fatalf("Allow %q, expected %q", response.Header.Get("Allow"), entityMethods)
+				}
+			}
+
+			ts = startTestServer(t, transportName, func(s *Server) { s.ErrorFormat = EmptyErrors })
+
+			response := ts.Do(t, getRequest("/users/100000"))
+			response.Expect(t, 404, nil)
+
+			if len(response.Body) != 0 {
+				t.Fatalf("body %q, expected none", response.Body)
+			}
+		})
+	}
+}
+
+func TestServer_HeadAndOptions(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			c.Send(t, getRequest("/users/1/visits"))
+			expected := c.Read(t)
+
+			// The connection stays usable after a response without a body.
+			for i := 0; i < 2; i++ {
+				c.Send(t, strings.Replace(getRequest("/users/1/visits"), "GET", "HEAD", 1))
+				response := c.ReadHead(t)
+
+				if response.StatusCode != 200 || response.Header.Get("Content-Length") != strconv.Itoa(len(expected.Body)) {
+					t.Fatalf("HEAD status %d, Content-Length %q, expected %d", response.StatusCode, response.Header.Get("Content-Length"), len(expected.Body))
+				}
+
+				if response.Header.Get("ETag") != expected.Header.Get("ETag") {
+					t.Fatalf("HEAD ETag %q, expected %q", response.Header.Get("ETag"), expected.Header.Get("ETag"))
+				}
+			}
+
+			c.Send(t, getRequest("/users/1/visits"))
+			c.Read(t).Expect(t, 200, expected.Body)
+
+			tests := []struct {
+				request    string
+				statusCode int
+				allow      string
+			}{
+				{"OPTIONS /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n", 204, entityMethods},
+				{"OPTIONS /locations/1/avg HTTP/1.1\r\nHost: travels.com\r\n\r\n", 204, queryMethods},
+				{"OPTIONS /visits/new HTTP/1.1\r\nHost: travels.com\r\n\r\n", 204, postMethods},
+				{getRequest("/users/new"), 405, postMethods},
+				{postRequest("/users/1/visits", `{}`), 405, queryMethods},
+				{"HEAD /visits/new HTTP/1.1\r\nHost: travels.com\r\n\r\n", 405, postMethods},
+			}
+
+			for _, test := range tests {
+				c.Send(t, test.request)
+				response := c.ReadHead(t)
+
+				if response.StatusCode != test.statusCode || response.Header.Get("Allow") != test.allow {
+					t.Fatalf("%q: status %d, Allow %q", test.request, response.StatusCode, response.Header.Get("Allow"))
+				}
+
+				// A 405 has a body even though ReadHead does not read it.
+				if test.statusCode == 405 {
+					c = ts.Dial(t)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_CORS(t *testing.T) {
+	const origin = "https://dashboard.example.com"
+
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.CORSOrigins = []string{"https://other.example.com", origin} })
+
+			response := ts.Do(t, strings.Replace(getRequest("/users/1"), "\r\n\r\n", "\r\nOrigin: "+origin+"\r\n\r\n", 1))
+			response.Expect(t, 200, nil)
+
+			if response.Header.Get("Access-Control-Allow-Origin") != origin || response.Header.Get("Vary") != "Origin" ||
+				response.Header.Get("Access-Control-Expose-Headers") != "ETag" {
+				t.Fatalf("unexpected CORS headers %v", response.Header)
+			}
+
+			preflight := "OPTIONS /users/1 HTTP/1.1\r\nHost: travels.com\r\nOrigin: " + origin + "\r\n" +
+				"Access-Control-Request-Method: POST\r\nAccess-Control-Request-Headers: If-Match\r\n\r\n"
+
+			response = ts.Do(t, preflight)
+
+			if response.StatusCode != 204 || response.Header.Get("Access-Control-Allow-Methods") != entityMethods ||
+				response.Header.Get("Access-Control-Allow-Headers") != corsAllowedHeaders {
+				t.Fatalf("unexpected preflight %d %v", response.StatusCode, response.Header)
+			}
+
+			response = ts.Do(t, strings.Replace(getRequest("/users/1"), "\r\n\r\n", "\r\nOrigin: https://evil.example.com\r\n\r\n", 1))
+
+			if response.Header.Get("Access-Control-Allow-Origin") != "" {
+				t.Fatalf("unknown origin allowed: %v", response.Header)
+			}
+		})
+	}
+}
+
+func TestServer_KeepAlive(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			expected := new(Response)
+
+			for id := 1; id <= 5; id++ {
+				user, _ := ts.DataBase.GetUser(id)
+				expected.WriteUser(user)
+
+				c.Send(t, getRequest("/users/"+strconv.Itoa(id)))
+				c.Read(t).Expect(t, 200, expected.Body)
+
+				c.Send(t, getRequest("/users/100000"))
+				c.Read(t).Expect(t, 404, nil)
+			}
+		})
+	}
+}
+
+func TestServer_ConnectionClose(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+
+			user, _ := ts.DataBase.GetUser(1)
+			expected := user.Serialize(nil)
+
+			tests := []struct {
+				request string
+				isClose bool
+			}{
+				{"GET /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n", false},
+				{"GET /users/1 HTTP/1.1\r\nHost: travels.com\r\nConnection: close\r\n\r\n", true},
+				{"GET /users/1 HTTP/1.1\r\nHost: travels.com\r\nconnection: Upgrade, Close\r\n\r\n", true},
+				{"GET /users/1 HTTP/1.0\r\nHost: travels.com\r\n\r\n", true},
+				{"GET /users/1 HTTP/1.0\r\nHost: travels.com\r\nConnection: Keep-Alive\r\n\r\n", false},
+			}
+
+			for _, test := range tests {
+				c := ts.Dial(t)
+
+				// The second request must not be answered when the first one closes the connection.
+				c.Send(t, test.request+test.request)
+
+				response := c.Read(t)
+				response.Expect(t, 200, expected)
+
+				if response.Close != test.isClose {
+					t.Fatalf("%q: close %t, expected %t", test.request, response.Close, test.isClose)
+				}
+
+				if test.isClose {
+					c.ExpectClosed(t)
+				} else {
+					c.Read(t).Expect(t, 200, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_IdleTimeout(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.IdleTimeout = 300 * time.Millisecond })
+			c := ts.Dial(t)
+
+			// Requests more often than the timeout keep the connection.
+			for i := 0; i < 4; i++ {
+				c.Send(t, getRequest("/users/1"))
+				c.Read(t).Expect(t, 200, nil)
+
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			startedAt := time.Now()
+			c.ExpectClosed(t)
+
+			if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+				t.Fatalf("idle connection closed after %s", elapsed)
+			}
+		})
+	}
+}
+
+// TestServer_NoIdleTimeout checks that a zero IdleTimeout keeps idle
+// connections past HeaderTimeout, which only bounds reading a request.
+func TestServer_NoIdleTimeout(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.HeaderTimeout = 200 * time.Millisecond })
+			c := ts.Dial(t)
+
+			c.Send(t, getRequest("/users/1"))
+			c.Read(t).Expect(t, 200, nil)
+
+			time.Sleep(500 * time.Millisecond)
+
+			c.Send(t, getRequest("/users/1"))
+			c.Read(t).Expect(t, 200, nil)
+
+			// Shutdown does not wait for the idle connection.
+			startedAt := time.Now()
+
+			if err := ts.Server.Shutdown(); err != nil {
+				t.Fatal(err)
+			}
+
+			if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+				t.Fatalf("shutdown took %s with an idle connection", elapsed)
+			}
+		})
+	}
+}
+
+func TestServer_Limits(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) {
+				s.MaxHeaderSize = 1024
+				s.MaxBodySize = 64
+			})
+
+			largeHeader := "GET /users/1 HTTP/1.1\r\nHost: travels.com\r\nCookie: " + strings.Repeat("a", 8<<10) + "\r\n\r\n"
+
+			// net/http writes this one itself without a Content-Length.
+			if response := ts.Do(t, largeHeader); response.StatusCode != 431 {
+				t.Fatalf("status %d, expected 431", response.StatusCode)
+			}
+
+			ts.Do(t, postRequest("/users/1", `{"email": "`+strings.Repeat("a", 100)+`@example.com"}`)).Expect(t, 413, nil)
+			ts.Do(t, postRequest("/users/1", `{"email": "a@example.com"}`)).Expect(t, 200, []byte(`{}`))
+		})
+	}
+}
+
+// TestServer_NoBodyLimit checks that a zero MaxBodySize disables the limit on
+// every transport, fasthttp alone would fall back to its 4 MB default.
+func TestServer_NoBodyLimit(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) {
+				s.MaxBodySize = 0
+				s.MaxBufferedBytes = 0
+			})
+
+			ts.Do(t, postRequest("/users/1", `{"email": "`+strings.Repeat("a", 5<<20)+`@example.com"}`)).Expect(t, 200, []byte(`{}`))
+		})
+	}
+}
+
+func TestServer_MaxBufferedBytes(t *testing.T) {
+	ts := startTestServer(t, "evio", func(s *Server) {
+		s.MaxBodySize = 0
+		s.MaxBufferedBytes = 512
+	})
+
+	c := ts.Dial(t)
+
+	c.Send(t, "POST /users/1 HTTP/1.1\r\nHost: travels.com\r\nContent-Length: 4096\r\n\r\n"+strings.Repeat(" ", 1024))
+	c.Read(t).Expect(t, 413, nil)
+	c.ExpectClosed(t)
+}
+
+func TestServer_HeaderTimeout(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName, func(s *Server) { s.HeaderTimeout = 300 * time.Millisecond })
+			c := ts.Dial(t)
+
+			c.Send(t, getRequest("/users/1"))
+			c.Read(t).Expect(t, 200, nil)
+
+			done := make(chan struct{})
+			defer close(done)
+
+			// Trickle a few header bytes, each of them must not extend the deadline. The
+			// writes stop before the timeout, data arriving after the close would reset
+			// the connection before the response is read.
+			go func() {
+				c.conn.Write([]byte("GET /users/1 HTTP/1.1\r\n"))
+
+				for i := 0; i < 4; i++ {
+					select {
+					case <-done:
+						return
+					case <-time.After(50 * time.Millisecond):
+						if _, err := c.conn.Write([]byte("a")); err != nil {
+							return
+						}
+					}
+				}
+			}()
+
+			startedAt := time.Now()
+
+			// net/http and fasthttp do not tell a timeout from a malformed header and answer with a 400.
+			expectedStatusCode := 400
+
+			if transportName == "evio" {
+				expectedStatusCode = 408
+			}
+
+			if response := c.Read(t); response.StatusCode != expectedStatusCode {
+				t.Fatalf("status %d, expected %d", response.StatusCode, expectedStatusCode)
+			}
+
+			c.ExpectClosed(t)
+
+			if elapsed := time.Since(startedAt); elapsed > 2*time.Second {
+				t.Fatalf("slow connection closed after %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			user, _ := ts.DataBase.GetUser(1)
+			location, _ := ts.DataBase.GetLocation(1)
+
+			expectedUser := user.Serialize(nil)
+			expectedLocation := location.Serialize(nil)
+
+			c.Send(t, getRequest("/users/1")+
+				getRequest("/users/100000")+
+				postRequest("/visits/1", `{"mark": 5}`)+
+				getRequest("/locations/1")+
+				getRequest("/visits/1"))
+
+			c.Read(t).Expect(t, 200, expectedUser)
+			c.Read(t).Expect(t, 404, nil)
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+			c.Read(t).Expect(t, 200, expectedLocation)
+
+			response := c.Read(t)
+			response.Expect(t, 200, response.Body)
+
+			if !strings.HasPrefix(string(response.Body), `{"mark":5,`) {
+				t.Fatalf("pipelined update is not visible: %s", response.Body)
+			}
+		})
+	}
+}
+
+func TestServer_SplitRequest(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			request := postRequest("/locations/1", `{"distance": 7}`)
+
+			for _, index := range []int{10, len(request) - 5} {
+				c.Send(t, request[:index])
+				time.Sleep(20 * time.Millisecond)
+				c.Send(t, request[index:])
+
+				c.Read(t).Expect(t, 200, []byte(`{}`))
+			}
+
+			response := ts.Do(t, getRequest("/locations/1"))
+			response.Expect(t, 200, response.Body)
+
+			if !strings.HasPrefix(string(response.Body), `{"distance":7,`) {
+				t.Fatalf("split update is not applied: %s", response.Body)
+			}
+		})
+	}
+}
+
+func TestServer_Post(t *testing.T) {
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+			c := ts.Dial(t)
+
+			user := `{"id": 1000, "email": "ivan@example.com", "first_name": "Ivan", "last_name": "Petrov", "gender": "m", "birth_date": -100}`
+			location := `{"id": 1000, "place": "Park", "country": "Chile", "city": "Santiago", "distance": 12}`
+			visit := `{"id": 10000, "user": 1000, "location": 1000, "visited_at": 1000000000, "mark": 4}`
+
+			c.Send(t, postRequest("/users/new", user))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, postRequest("/users/new", user))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, postRequest("/locations/new", location))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, postRequest("/visits/new", visit))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			// A brace in a header value does not move the start of the body.
+			c.Send(t, strings.Replace(postRequest("/users/1000", `{"email": "petrov@example.com"}`), "\r\n", "\r\nX-Note: {\"email\": null}\r\n", 1))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, postRequest("/users/1000", `{"email": "petrov@example.com", "gender": "f"}`))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, getRequest("/users/1000"))
+			c.Read(t).Expect(t, 200, []byte(`{"first_name":"Ivan","last_name":"Petrov","gender":"f","email":"petrov@example.com","birth_date":-100,"id":1000}`))
+
+			c.Send(t, getRequest("/users/1000/visits"))
+			c.Read(t).Expect(t, 200, []byte(`{"visits": [{"mark":4,"visited_at":1000000000,"place":"Park"}]}`))
+
+			c.Send(t, getRequest("/locations/1000/avg?gender=f"))
+			c.Read(t).Expect(t, 200, []byte(`{"avg": 4.000000}`))
+
+			c.Send(t, postRequest("/users/new", `{"id": 1001, "email": "a@example.com"}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, postRequest("/users/1000", `{"email": null}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, postRequest("/visits/1", `{"mark": 6}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, postRequest("/users/100000", `{"email": "a@example.com"}`))
+			c.Read(t).Expect(t, 404, nil)
+
+			// Out of range fields are rejected, so the records never reach the serializers.
+			c.Send(t, postRequest("/visits/new", `{"id": 10001, "user": 1000, "location": 1000, "visited_at": -10, "mark": 4}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, getRequest("/visits/10001"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, postRequest("/visits/10000", `{"visited_at": -10}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, getRequest("/visits/10000"))
+			c.Read(t).Expect(t, 200, []byte(`{"mark":4,"visited_at":1000000000,"user":1000,"id":10000,"location":1000}`))
+
+			c.Send(t, getRequest("/users/1000/visits"))
+			c.Read(t).Expect(t, 200, []byte(`{"visits": [{"mark":4,"visited_at":1000000000,"place":"Park"}]}`))
+
+			c.Send(t, postRequest("/locations/new", `{"id": 1001, "place": "Park", "country": "Chile", "city": "Santiago", "distance": -1}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			c.Send(t, getRequest("/locations/1001"))
+			c.Read(t).Expect(t, 404, nil)
+
+			c.Send(t, postRequest("/users/1000", `{"birth_date": 99999999999}`))
+			c.Read(t).Expect(t, 400, nil)
+
+			// Stored strings are escaped, so quotes and backslashes keep the body valid JSON.
+			c.Send(t, postRequest("/users/1000", `{"first_name": "q\"}", "last_name": "back\\slash\n"}`))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			c.Send(t, postRequest("/locations/1000", `{"place": "P\""}`))
+			c.Read(t).Expect(t, 200, []byte(`{}`))
+
+			var stored struct {
+				FirstName string `json:"first_name"`
+				LastName  string `json:"last_name"`
+				Visits    []struct {
+					Place string `json:"place"`
+				} `json:"visits"`
+			}
+
+			c.Send(t, getRequest("/users/1000"))
+
+			if response := c.Read(t); json.Unmarshal(response.Body, &stored) != nil || stored.FirstName != `q"}` || stored.LastName != "back\\slash\n" {
+				t.Fatalf("user with escaped strings serialized as %s", response.Body)
+			}
+
+			c.Send(t, getRequest("/users/1000/visits"))
+
+			if response := c.Read(t); json.Unmarshal(response.Body, &stored) != nil || len(stored.Visits) != 1 || stored.Visits[0].Place != `P"` {
+				t.Fatalf("visited place with a quote serialized as %s", response.Body)
+			}
+		})
+	}
+}
+
+// TestServer_ConcurrentMutations updates visits on several connections while
+// others read the indexes they change. The race detector treats socket IO as
+// synchronization, so unlocked access is caught by the db package tests.
+func TestServer_ConcurrentMutations(t *testing.T) {
+	const countConnections = 4
+	const countRequests = 50
+
+	for _, transportName := range testTransports {
+		t.Run(transportName, func(t *testing.T) {
+			ts := startTestServer(t, transportName)
+
+			var waitGroup sync.WaitGroup
+
+			errs := make(chan error, countConnections)
+
+			for connection := 0; connection < countConnections; connection++ {
+				waitGroup.Add(1)
+
+				go func(connection int) {
+					defer waitGroup.Done()
+
+					conn, err := net.DialTimeout("tcp", ts.Addr, testTimeout)
+
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					defer conn.Close()
+
+					reader := bufio.NewReader(conn)
+
+					for i := 0; i < countRequests; i++ {
+						id := strconv.Itoa(1 + (connection*countRequests+i)%50)
+
+						request := getRequest("/users/" + id + "/visits")
+
+						switch {
+						case connection%2 == 0:
+							request = postRequest("/visits/"+id, `{"user": `+strconv.Itoa(1+i%50)+`, "visited_at": `+strconv.Itoa(1000000000+i)+`}`)
+						case i%2 == 0:
+							request = getRequest("/locations/" + id + "/avg")
+						}
+
+						conn.SetDeadline(time.Now().Add(testTimeout))
+
+						if _, err := conn.Write([]byte(request)); err != nil {
+							errs <- err
+							return
+						}
+
+						response, err := http.ReadResponse(reader, nil)
+
+						if err != nil {
+							errs <- err
+							return
+						}
+
+						io.Copy(ioutil.Discard, response.Body)
+						response.Body.Close()
+
+						if response.StatusCode != 200 {
+							errs <- fmt.Errorf("%s: status %d", strings.SplitN(request, "\r\n", 2)[0], response.StatusCode)
+							return
+						}
+					}
+				}(connection)
+			}
+
+			waitGroup.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
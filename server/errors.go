@@ -0,0 +1,50 @@
+package server
+
+import (
+	"fmt"
+)
+
+// ErrorFormat selects the body of error responses. TextErrors sends the
+// reason phrase and EmptyErrors nothing, the competition checks only the
+// status of errors. JSONErrors sends {"error": ..., "field": ...}.
+type ErrorFormat int
+
+const (
+	TextErrors ErrorFormat = iota
+	EmptyErrors
+	JSONErrors
+)
+
+func ParseErrorFormat(name string) (ErrorFormat, error) {
+	switch name {
+	case "text":
+		return TextErrors, nil
+	case "empty":
+		return EmptyErrors, nil
+	case "json":
+		return JSONErrors, nil
+	}
+
+	return TextErrors, fmt.Errorf("unknown error format %q", name)
+}
+
+// RequestError tells why a request was rejected. Field is the query parameter
+// or body field at fault, empty when the request is wrong as a whole.
+type RequestError struct {
+	Field   string
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+
+	return e.Field + ": " + e.Message
+}
+
+var errMalformedBody = &RequestError{Message: "body is not a JSON object"}
+
+func fieldError(field string, message string) error {
+	return &RequestError{Field: field, Message: message}
+}
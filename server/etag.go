@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"strconv"
+)
+
+var ifNoneMatchHeader = []byte("If-None-Match")
+var ifMatchHeader = []byte("If-Match")
+
+var weakPrefix = []byte("W/")
+
+// appendETag quotes the entity version, a compressed body gets its own tag
+// as it is a different representation.
+func appendETag(out []byte, version uint64, contentEncoding string) []byte {
+	out = append(out, '"')
+	out = strconv.AppendUint(out, version, 10)
+
+	if contentEncoding != "" {
+		out = append(out, '-')
+		out = append(out, contentEncoding...)
+	}
+
+	return append(out, '"')
+}
+
+// isETagMatched reports whether a list of entity tags names the version in
+// any of its encodings. Weak tags match as well, this is for If-None-Match.
+func isETagMatched(tags []byte, version uint64) bool {
+	return matchETag(tags, version, true)
+}
+
+// isStrongETagMatched is for If-Match, a weak tag cannot vouch for the exact version.
+func isStrongETagMatched(tags []byte, version uint64) bool {
+	return matchETag(tags, version, false)
+}
+
+// ifMatch turns the If-Match header of an update into a check the database
+// runs under its write lock, nil without the header.
+func ifMatch(request *Request) db.Precondition {
+	if len(request.IfMatch) == 0 {
+		return nil
+	}
+
+	return func(version uint64) bool {
+		return isStrongETagMatched(request.IfMatch, version)
+	}
+}
+
+func matchETag(tags []byte, version uint64, isWeakAllowed bool) bool {
+	var buffer [20]byte
+
+	formattedVersion := strconv.AppendUint(buffer[:0], version, 10)
+
+	for len(tags) > 0 {
+		tag := tags
+		tags = nil
+
+		if index := bytes.IndexByte(tag, ','); index != -1 {
+			tag, tags = tag[:index], tag[index+1:]
+		}
+
+		tag = bytes.TrimSpace(tag)
+
+		if len(tag) == 1 && tag[0] == '*' {
+			return true
+		}
+
+		if bytes.HasPrefix(tag, weakPrefix) {
+			if !isWeakAllowed {
+				continue
+			}
+
+			tag = tag[len(weakPrefix):]
+		}
+
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+
+		tag = tag[1 : len(tag)-1]
+
+		if index := bytes.IndexByte(tag, '-'); index != -1 {
+			tag = tag[:index]
+		}
+
+		if bytes.Equal(tag, formattedVersion) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestIsETagMatched(t *testing.T) {
+	tests := []struct {
+		tags      string
+		isMatched bool
+	}{
+		{``, false},
+		{`"42"`, true},
+		{`"42-gzip"`, true},
+		{`W/"42"`, true},
+		{`"41", "42"`, true},
+		{` "1" ,"42-deflate" `, true},
+		{`*`, true},
+		{`"420"`, false},
+		{`"4"`, false},
+		{`42`, false},
+		{`"42`, false},
+		{`"", "-42"`, false},
+	}
+
+	for _, test := range tests {
+		if isMatched := isETagMatched([]byte(test.tags), 42); isMatched != test.isMatched {
+			t.Errorf("%q: matched %v, expected %v", test.tags, isMatched, test.isMatched)
+		}
+	}
+
+	for _, tags := range []string{`W/"42"`, `W/"42-gzip"`} {
+		if isStrongETagMatched([]byte(tags), 42) {
+			t.Errorf("%q: weak tag matched strongly", tags)
+		}
+	}
+
+	for _, tags := range []string{`"42"`, `"42-gzip"`, `W/"42", "42"`, `*`} {
+		if !isStrongETagMatched([]byte(tags), 42) {
+			t.Errorf("%q: strong tag did not match", tags)
+		}
+	}
+
+	if etag := appendETag(nil, 18446744073709551615, "gzip"); string(etag) != `"18446744073709551615-gzip"` {
+		t.Errorf("unexpected etag %s", etag)
+	}
+}
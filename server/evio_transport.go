@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bufio"
+	"github.com/tidwall/evio"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EvioTransport struct {
+	NumLoops         int
+	lastConnectionId uint64
+	isShutdown       int32
+	// connections maps *RequestContext to evio.Conn while a timeout is on.
+	connections sync.Map
+}
+
+func (t *EvioTransport) Serve(s *Server, port int) error {
+	var events evio.Events
+
+	events.NumLoops = 4
+	events.LoadBalance = evio.RoundRobin
+
+	if t.NumLoops != 0 {
+		events.NumLoops = t.NumLoops
+	}
+
+	events.Serving = func(server evio.Server) (action evio.Action) {
+		s.serving(server.Addrs[0])
+		return
+	}
+
+	events.Tick = func() (delay time.Duration, action evio.Action) {
+		// No wake ups once shutting down, the loops close their wake up descriptors
+		// and a late write would land on whatever reuses the descriptor number.
+		if atomic.LoadInt32(&t.isShutdown) == 1 {
+			action = evio.Shutdown
+			return
+		}
+
+		if s.IdleTimeout > 0 || s.HeaderTimeout > 0 {
+			t.wakeExpired(s)
+		}
+
+		delay = 100 * time.Millisecond
+		return
+	}
+
+	events.Opened = func(c evio.Conn) (out []byte, opts evio.Options, action evio.Action) {
+		ctx := &RequestContext{Id: atomic.AddUint64(&t.lastConnectionId, 1)}
+		c.SetContext(ctx)
+
+		if s.IdleTimeout > 0 || s.HeaderTimeout > 0 {
+			ctx.lastActiveAt = time.Now().UnixNano()
+			t.connections.Store(ctx, c)
+		}
+
+		opts.ReuseInputBuffer = true
+		opts.TCPKeepAlive = 30 * time.Second
+		return
+	}
+
+	events.Closed = func(c evio.Conn, err error) (action evio.Action) {
+		if s.IdleTimeout > 0 || s.HeaderTimeout > 0 {
+			t.connections.Delete(c.Context())
+		}
+
+		return
+	}
+
+	// A streamed body is written by its own goroutine once the headers are out,
+	// the detached connection is closed after it, which ends the body.
+	events.Detached = func(c evio.Conn, conn io.ReadWriteCloser) (action evio.Action) {
+		ctx := c.Context().(*RequestContext)
+
+		if s.IdleTimeout > 0 || s.HeaderTimeout > 0 {
+			t.connections.Delete(ctx)
+		}
+
+		go writeStream(ctx.stream, conn)
+
+		return
+	}
+
+	events.Data = func(c evio.Conn, in []byte) (out []byte, action evio.Action) {
+		ctx := c.Context().(*RequestContext)
+
+		// A nil packet is a wake up from wakeExpired, the connection may have been used since.
+		if in == nil {
+			now := time.Now().UnixNano()
+
+			if isHeaderExpired(s, ctx, now) {
+				out = s.appendError(ctx.Out[:0], 408)
+				action = evio.Close
+			} else if isIdleExpired(s, ctx, now) {
+				action = evio.Close
+			}
+
+			return
+		}
+
+		if s.IdleTimeout > 0 {
+			atomic.StoreInt64(&ctx.lastActiveAt, time.Now().UnixNano())
+		}
+
+		data := ctx.InputStream.Begin(in)
+
+		if s.Recorder != nil {
+			if err := s.Recorder.Record(ctx.Id, in); err != nil {
+				log.Println(err)
+			}
+		}
+
+		out = ctx.Out[:0]
+
+		// A packet may hold several pipelined requests or only a part of one,
+		// the incomplete tail stays in the input stream until more data arrives.
+		for len(data) > 0 {
+			length, statusCode := s.requestLength(data)
+
+			if statusCode != 200 {
+				out = s.appendError(out, statusCode)
+				action = evio.Close
+				data = data[:0]
+				break
+			}
+
+			if length == 0 {
+				break
+			}
+
+			var isClose bool
+
+			out, isClose, ctx.stream = s.serveRaw(data[:length], out)
+			data = data[length:]
+
+			if ctx.stream != nil {
+				action = evio.Detach
+				data = data[:0]
+				break
+			}
+
+			if isClose {
+				action = evio.Close
+				data = data[:0]
+				break
+			}
+		}
+
+		if s.MaxBufferedBytes > 0 && len(data) > s.MaxBufferedBytes {
+			out = s.appendError(out, 413)
+			action = evio.Close
+			data = data[:0]
+		}
+
+		if s.HeaderTimeout > 0 {
+			headerStartedAt := int64(0)
+
+			if headersEnd, _ := findHeadersEnd(data); len(data) > 0 && headersEnd == -1 {
+				headerStartedAt = atomic.LoadInt64(&ctx.headerStartedAt)
+
+				if headerStartedAt == 0 {
+					headerStartedAt = time.Now().UnixNano()
+				}
+			}
+
+			atomic.StoreInt64(&ctx.headerStartedAt, headerStartedAt)
+		}
+
+		ctx.InputStream.End(data)
+		return
+	}
+
+	return evio.Serve(events, "tcp4://:"+strconv.Itoa(port))
+}
+
+func writeStream(stream func(w io.Writer) error, conn io.WriteCloser) {
+	writer := bufio.NewWriterSize(conn, 1<<16)
+
+	if err := stream(writer); err == nil {
+		writer.Flush()
+	}
+
+	conn.Close()
+}
+
+// wakeExpired wakes the connections which are idle or too slow to send
+// headers, their own loop closes them in Data.
+func (t *EvioTransport) wakeExpired(s *Server) {
+	now := time.Now().UnixNano()
+
+	t.connections.Range(func(key interface{}, value interface{}) bool {
+		if isExpired(s, key.(*RequestContext), now) {
+			value.(evio.Conn).Wake()
+		}
+
+		return true
+	})
+}
+
+func isExpired(s *Server, ctx *RequestContext, now int64) bool {
+	return isIdleExpired(s, ctx, now) || isHeaderExpired(s, ctx, now)
+}
+
+func isIdleExpired(s *Server, ctx *RequestContext, now int64) bool {
+	return s.IdleTimeout > 0 && now-atomic.LoadInt64(&ctx.lastActiveAt) >= int64(s.IdleTimeout)
+}
+
+// isHeaderExpired reports a connection which has been sending the same
+// request headers for longer than HeaderTimeout, it is answered with a 408.
+func isHeaderExpired(s *Server, ctx *RequestContext, now int64) bool {
+	headerStartedAt := atomic.LoadInt64(&ctx.headerStartedAt)
+
+	return s.HeaderTimeout > 0 && headerStartedAt != 0 && now-headerStartedAt >= int64(s.HeaderTimeout)
+}
+
+func (t *EvioTransport) Shutdown() error {
+	atomic.StoreInt32(&t.isShutdown, 1)
+	return nil
+}
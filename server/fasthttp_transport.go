@@ -0,0 +1,196 @@
+package server
+
+import (
+	"bufio"
+	"github.com/valyala/fasthttp"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fasthttpMaxHeaderSize is the read buffer when Server.MaxHeaderSize is zero,
+// fasthttp reads the headers into one buffer of a fixed size.
+const fasthttpMaxHeaderSize = 64 << 10
+
+// FasthttpTransport keeps the read deadlines itself, fasthttp has a single
+// ReadTimeout for waiting on a request and reading it. A connection waits for
+// a request for Server.IdleTimeout and, from its first byte, reads it within
+// Server.HeaderTimeout. fasthttp takes zero limits as its own defaults, so
+// disabled limits are mapped.
+type FasthttpTransport struct {
+	server *fasthttp.Server
+	mutex  sync.Mutex
+	conns  map[*fasthttpConn]struct{}
+	// isShutdown closes the connections as soon as they become idle,
+	// fasthttp.Server.Shutdown waits for them otherwise.
+	isShutdown int32
+}
+
+// fasthttpConn moves from the idle deadline to the header deadline when the
+// first byte of a request is read.
+type fasthttpConn struct {
+	net.Conn
+	server *Server
+	isIdle int32
+}
+
+func (c *fasthttpConn) Read(data []byte) (int, error) {
+	n, err := c.Conn.Read(data)
+
+	if n > 0 && atomic.CompareAndSwapInt32(&c.isIdle, 1, 0) {
+		setReadTimeout(c.Conn, c.server.HeaderTimeout)
+	}
+
+	return n, err
+}
+
+// fasthttpListener starts every connection with the header deadline, as net/http does.
+type fasthttpListener struct {
+	net.Listener
+	server *Server
+}
+
+func (l *fasthttpListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+
+	if err != nil {
+		return nil, err
+	}
+
+	setReadTimeout(conn, l.server.HeaderTimeout)
+
+	return &fasthttpConn{Conn: conn, server: l.server}, nil
+}
+
+func (t *FasthttpTransport) Serve(s *Server, port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+
+	if err != nil {
+		return err
+	}
+
+	t.conns = make(map[*fasthttpConn]struct{})
+
+	t.server = &fasthttp.Server{
+		ReadBufferSize:     s.MaxHeaderSize,
+		MaxRequestBodySize: s.MaxBodySize,
+		ConnState:          t.connState,
+	}
+
+	if s.MaxHeaderSize == 0 {
+		t.server.ReadBufferSize = fasthttpMaxHeaderSize
+	}
+
+	if s.MaxBodySize == 0 {
+		t.server.MaxRequestBodySize = math.MaxInt32
+	}
+
+	t.server.Handler = func(ctx *fasthttp.RequestCtx) {
+		request, statusCode := s.prepareRequest(ctx.Method(), ctx.Path(), ctx.URI().QueryString(), ctx.PostBody())
+		request.AcceptEncoding = ctx.Request.Header.Peek("Accept-Encoding")
+		request.IfNoneMatch = ctx.Request.Header.Peek("If-None-Match")
+		request.IfMatch = ctx.Request.Header.Peek("If-Match")
+		request.Origin = ctx.Request.Header.Peek("Origin")
+
+		response := s.acquireResponse()
+
+		s.serve(request, statusCode, response)
+		writeFasthttpResponse(ctx, response)
+
+		// fasthttp only understands a bare "close", not a token list.
+		if hasToken(ctx.Request.Header.Peek("Connection"), closeToken) {
+			ctx.SetConnectionClose()
+		}
+
+		s.releaseResponse(response)
+		s.releaseRequest(request)
+	}
+
+	t.server.ErrorHandler = func(ctx *fasthttp.RequestCtx, err error) {
+		response := s.acquireResponse()
+
+		if _, isSmallBuffer := err.(*fasthttp.ErrSmallBuffer); isSmallBuffer {
+			response.WriteError(431, nil)
+		} else if err == fasthttp.ErrBodyTooLarge {
+			response.WriteError(413, nil)
+		} else {
+			response.WriteError(400, nil)
+		}
+
+		writeFasthttpResponse(ctx, response)
+		s.releaseResponse(response)
+	}
+
+	s.serving(listener.Addr())
+
+	return t.server.Serve(&fasthttpListener{listener, s})
+}
+
+func (t *FasthttpTransport) Shutdown() error {
+	atomic.StoreInt32(&t.isShutdown, 1)
+
+	t.mutex.Lock()
+
+	for conn := range t.conns {
+		if atomic.LoadInt32(&conn.isIdle) == 1 {
+			conn.SetReadDeadline(time.Now())
+		}
+	}
+
+	t.mutex.Unlock()
+
+	return t.server.Shutdown()
+}
+
+func (t *FasthttpTransport) connState(netConn net.Conn, state fasthttp.ConnState) {
+	conn := netConn.(*fasthttpConn)
+
+	switch state {
+	case fasthttp.StateNew:
+		t.mutex.Lock()
+		t.conns[conn] = struct{}{}
+		t.mutex.Unlock()
+	case fasthttp.StateIdle:
+		setReadTimeout(conn.Conn, conn.server.IdleTimeout)
+		atomic.StoreInt32(&conn.isIdle, 1)
+
+		if atomic.LoadInt32(&t.isShutdown) == 1 {
+			conn.SetReadDeadline(time.Now())
+		}
+	case fasthttp.StateHijacked, fasthttp.StateClosed:
+		t.mutex.Lock()
+		delete(t.conns, conn)
+		t.mutex.Unlock()
+	}
+}
+
+// writeFasthttpResponse sends a streamed body chunked, fasthttp writes it
+// once the handler has returned.
+func writeFasthttpResponse(ctx *fasthttp.RequestCtx, response *Response) {
+	ctx.SetStatusCode(response.StatusCode)
+	ctx.SetContentType(response.ContentType())
+
+	if stream := response.Stream; stream != nil && !response.IsHead {
+		ctx.SetBodyStreamWriter(func(w *bufio.Writer) { stream(w) })
+	} else {
+		ctx.SetBody(response.Body)
+	}
+
+	response.headers = response.appendHeaders(response.headers[:0])
+
+	forEachHeader(response.headers, func(name []byte, value []byte) {
+		ctx.Response.Header.SetBytesKV(name, value)
+	})
+}
+
+// setReadTimeout sets the read deadline timeout from now, zero clears it.
+func setReadTimeout(conn net.Conn, timeout time.Duration) {
+	if timeout == 0 {
+		conn.SetReadDeadline(time.Time{})
+	} else {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+}
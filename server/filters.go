@@ -0,0 +1,118 @@
+package server
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+func parseIntParam(query map[string]string, name string, value *int) error {
+	received, isExist := query[name]
+
+	if !isExist {
+		return nil
+	}
+
+	if len(received) == 0 {
+		return fieldError(name, "must not be empty")
+	}
+
+	parsed, err := strconv.Atoi(received)
+
+	if err != nil {
+		return fieldError(name, "must be an integer")
+	}
+
+	*value = parsed
+
+	return nil
+}
+
+func parseBoolParam(query map[string]string, name string, value *bool) error {
+	received, isExist := query[name]
+
+	if !isExist {
+		return nil
+	}
+
+	parsed, err := strconv.ParseBool(received)
+
+	if err != nil {
+		return fieldError(name, "must be true or false")
+	}
+
+	*value = parsed
+
+	return nil
+}
+
+func parseVisitedPlacesFilter(query map[string]string, filter *db.VisitedPlacesFilter) error {
+	if err := parseIntParam(query, "fromDate", &filter.FromDate); err != nil {
+		return err
+	}
+
+	if err := parseIntParam(query, "toDate", &filter.ToDate); err != nil {
+		return err
+	}
+
+	if err := parseIntParam(query, "toDistance", &filter.ToDistance); err != nil {
+		return err
+	}
+
+	if countryReceived, isExist := query["country"]; isExist {
+		if len(countryReceived) == 0 {
+			return fieldError("country", "must not be empty")
+		}
+
+		country, err := url.QueryUnescape(countryReceived)
+
+		if err != nil {
+			return fieldError("country", "is not properly escaped")
+		}
+
+		filter.Country = country
+	}
+
+	return nil
+}
+
+func parseAvgMarkFilter(query map[string]string, filter *db.AvgMarkFilter) error {
+	if err := parseIntParam(query, "fromDate", &filter.FromDate); err != nil {
+		return err
+	}
+
+	if err := parseIntParam(query, "toDate", &filter.ToDate); err != nil {
+		return err
+	}
+
+	if err := parseIntParam(query, "fromAge", &filter.FromAge); err != nil {
+		return err
+	}
+
+	if err := parseIntParam(query, "toAge", &filter.ToAge); err != nil {
+		return err
+	}
+
+	if genderReceived, isExist := query["gender"]; isExist {
+		if genderReceived != "m" && genderReceived != "f" {
+			return fieldError("gender", "must be m or f")
+		}
+
+		filter.Gender = genderReceived
+	}
+
+	return nil
+}
+
+// parsePurgeBefore reads the unix time the purge route clears tombstones up
+// to, without one every tombstone is cleared.
+func parsePurgeBefore(query map[string]string) (int64, error) {
+	before := int(time.Now().Unix()) + 1
+
+	if err := parseIntParam(query, "before", &before); err != nil {
+		return 0, err
+	}
+
+	return int64(before), nil
+}
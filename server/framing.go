@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"github.com/valyala/fasthttp"
+)
+
+var contentLengthHeader = []byte("Content-Length")
+var connectionHeader = []byte("Connection")
+
+var closeToken = []byte("close")
+var keepAliveToken = []byte("keep-alive")
+var http10Protocol = []byte("HTTP/1.0")
+
+// requestLength returns the length of the first complete request in data
+// with status 200, length 0 when more bytes are needed. Other statuses answer
+// a request over the limits or with a malformed Content-Length.
+func (s *Server) requestLength(data []byte) (length int, statusCode int) {
+	headersEnd, bodyStart := findHeadersEnd(data)
+
+	if headersEnd == -1 {
+		if s.MaxHeaderSize > 0 && len(data) > s.MaxHeaderSize {
+			return 0, 431
+		}
+
+		return 0, 200
+	}
+
+	if s.MaxHeaderSize > 0 && bodyStart > s.MaxHeaderSize {
+		return 0, 431
+	}
+
+	contentLength := 0
+
+	if value := findHeader(data[:headersEnd], contentLengthHeader); value != nil {
+		parsed, err := fasthttp.ParseUint(value)
+
+		if err != nil {
+			return 0, 400
+		}
+
+		contentLength = parsed
+	}
+
+	if s.MaxBodySize > 0 && contentLength > s.MaxBodySize {
+		return 0, 413
+	}
+
+	if len(data)-bodyStart < contentLength {
+		return 0, 200
+	}
+
+	return bodyStart + contentLength, 200
+}
+
+// findHeadersEnd returns the index of the line feed ending the last header
+// and the index of the body, or -1 when the headers are incomplete. Header
+// lines may end with "\r\n" or a bare "\n".
+func findHeadersEnd(data []byte) (headersEnd int, bodyStart int) {
+	for offset := 0; offset < len(data); {
+		index := bytes.IndexByte(data[offset:], '\n')
+
+		if index == -1 {
+			break
+		}
+
+		index += offset
+
+		if index+1 < len(data) && data[index+1] == '\n' {
+			return index, index + 2
+		}
+
+		if index+2 < len(data) && data[index+1] == '\r' && data[index+2] == '\n' {
+			return index, index + 3
+		}
+
+		offset = index + 1
+	}
+
+	return -1, 0
+}
+
+// findHeader returns the trimmed value of the first header called name, it
+// stops at the blank line before the body and returns nil when there is none.
+func findHeader(headers []byte, name []byte) []byte {
+	for len(headers) > 0 {
+		line := headers
+		headers = nil
+
+		if index := bytes.IndexByte(line, '\n'); index != -1 {
+			line, headers = line[:index], line[index+1:]
+		}
+
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\r') {
+			return nil
+		}
+
+		index := bytes.IndexByte(line, ':')
+
+		if index != -1 && bytes.EqualFold(line[:index], name) {
+			return bytes.TrimSpace(line[index+1:])
+		}
+	}
+
+	return nil
+}
+
+// isCloseRequested tells whether the connection ends after the response:
+// HTTP/1.1 keeps it unless the client sends "Connection: close", HTTP/1.0
+// closes it unless the client sends "Connection: keep-alive".
+func isCloseRequested(protocol []byte, connection []byte) bool {
+	if bytes.Equal(protocol, http10Protocol) {
+		return !hasToken(connection, keepAliveToken)
+	}
+
+	return hasToken(connection, closeToken)
+}
+
+func hasToken(value []byte, token []byte) bool {
+	for len(value) > 0 {
+		item := value
+		value = nil
+
+		if index := bytes.IndexByte(item, ','); index != -1 {
+			item, value = item[:index], item[index+1:]
+		}
+
+		if bytes.EqualFold(bytes.TrimSpace(item), token) {
+			return true
+		}
+	}
+
+	return false
+}
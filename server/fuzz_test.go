@@ -0,0 +1,92 @@
+package server
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"testing"
+)
+
+func newFuzzServer(f *testing.F) *Server {
+	options := generator.TrainOptions()
+
+	options.CountUsers = 20
+	options.CountLocations = 20
+	options.CountVisits = 100
+
+	database, err := generator.GenerateAndLoad(f.TempDir(), options)
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	return NewServer(database)
+}
+
+func FuzzServeRaw(f *testing.F) {
+	server := newFuzzServer(f)
+
+	f.Add([]byte("GET /users/1 HTTP/1.1\r\nHost: travels.com\r\n\r\n"))
+	f.Add([]byte("GET /users/1/visits?fromDate=1&toDate=2000000000&country=%D0%A0 HTTP/1.1\r\nHost: travels.com\r\n\r\n"))
+	f.Add([]byte("GET /locations/2/avg?gender=m&fromAge=10&toAge=40 HTTP/1.1\r\n\r\n"))
+	f.Add([]byte("POST /users/new HTTP/1.1\r\nContent-Length: 12\r\n\r\n{\"id\": 1000}"))
+	f.Add([]byte("POST /visits/3 HTTP/1.1\r\n\r\n{\"mark\": 2, \"user\": 4}"))
+	f.Add([]byte("GET /users/1 HTTP/1.1\r\nIf-None-Match: W/\"1\", *\r\n\r\n"))
+	f.Add([]byte("DELETE /visits/1 HTTP/1.1\r\n\r\n"))
+	f.Add([]byte("GET /users/1?"))
+	f.Add([]byte("GET"))
+	f.Add([]byte(""))
+
+	// A create which stored a negative visited_at used to crash every later read of the visit.
+	f.Add([]byte("POST /visits/new HTTP/1.1\r\nContent-Length: 72\r\n\r\n" +
+		`{"id": 101, "user": 1, "location": 1, "visited_at": -10, "mark": 3}     ` +
+		"GET /visits/101 HTTP/1.1\r\n\r\nGET /users/1/visits HTTP/1.1\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Pipelined requests are served in turn like a transport does, so an
+		// input can store a record and read it back.
+		for len(data) > 0 {
+			length, statusCode := server.requestLength(data)
+
+			if length == 0 || statusCode != 200 {
+				length = len(data)
+			}
+
+			out, _ := server.ServeRaw(data[:length], nil)
+			data = data[length:]
+
+			if len(out) < 12 {
+				t.Fatalf("short response %q", out)
+			}
+
+			switch string(out[9:12]) {
+			case "200", "204", "304", "400", "404", "405", "409", "412":
+			default:
+				t.Fatalf("unexpected status line %q", out)
+			}
+		}
+	})
+}
+
+func FuzzPrepareRequest(f *testing.F) {
+	server := newFuzzServer(f)
+
+	f.Add([]byte("GET"), []byte("/users/1/visits"), []byte("fromDate=1&country=abc"), []byte(nil))
+	f.Add([]byte("GET"), []byte("/locations/1/avg"), []byte("gender=f&&=&toAge"), []byte(nil))
+	f.Add([]byte("POST"), []byte("/locations/new"), []byte(nil), []byte(`{"id": 100, "place": "a", "country": "b", "city": "c", "distance": 1}`))
+	f.Add([]byte("POST"), []byte("/users/99999999999999999999"), []byte(nil), []byte(`{"email": null}`))
+
+	f.Fuzz(func(t *testing.T, method []byte, path []byte, query []byte, body []byte) {
+		request, statusCode := server.prepareRequest(method, path, query, body)
+		response := server.acquireResponse()
+
+		server.Handle(request, statusCode, response)
+
+		switch response.StatusCode {
+		case 200, 204, 400, 404, 405, 409:
+		default:
+			t.Fatalf("unexpected status %d", response.StatusCode)
+		}
+
+		server.releaseResponse(response)
+		server.releaseRequest(request)
+	})
+}
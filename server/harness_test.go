@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/generator"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testTransports = []string{"evio", "http", "fasthttp"}
+
+const testTimeout = 5 * time.Second
+
+// testServer is a Server listening on an ephemeral port over a real
+// transport, stopped when the test finishes.
+type testServer struct {
+	Server   *Server
+	DataBase *db.DataBase
+	Addr     string
+}
+
+type testConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type testResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Close      bool
+}
+
+// startTestServer applies configure to the server before it starts listening.
+func startTestServer(t *testing.T, transportName string, configure ...func(s *Server)) *testServer {
+	t.Helper()
+
+	options := generator.TrainOptions()
+
+	options.CountUsers = 50
+	options.CountLocations = 50
+	options.CountVisits = 500
+
+	database, err := generator.GenerateAndLoad(t.TempDir(), options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport, err := NewTransport(transportName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(database)
+	server.Transport = transport
+
+	for _, apply := range configure {
+		apply(server)
+	}
+
+	addrs := make(chan net.Addr, 1)
+	errs := make(chan error, 1)
+
+	server.Serving = func(addr net.Addr) {
+		addrs <- addr
+	}
+
+	go func() {
+		errs <- transport.Serve(server, 0)
+	}()
+
+	var addr net.Addr
+
+	select {
+	case addr = <-addrs:
+	case err := <-errs:
+		t.Fatalf("%s: %v", transportName, err)
+	case <-time.After(testTimeout):
+		t.Fatalf("%s: server did not start", transportName)
+	}
+
+	t.Cleanup(func() {
+		if err := server.Shutdown(); err != nil {
+			t.Error(err)
+		}
+
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(testTimeout):
+			t.Errorf("%s: server did not stop", transportName)
+		}
+	})
+
+	return &testServer{
+		Server:   server,
+		DataBase: database,
+		Addr:     "127.0.0.1:" + strconv.Itoa(addr.(*net.TCPAddr).Port),
+	}
+}
+
+// Dial opens a keep-alive connection which is closed when the test finishes.
+func (ts *testServer) Dial(t *testing.T) *testConn {
+	t.Helper()
+
+	conn, err := net.DialTimeout("tcp", ts.Addr, testTimeout)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return &testConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Do sends a raw request on a new connection and reads the response.
+func (ts *testServer) Do(t *testing.T, request string) *testResponse {
+	t.Helper()
+
+	c := ts.Dial(t)
+	c.Send(t, request)
+
+	return c.Read(t)
+}
+
+func (c *testConn) Send(t *testing.T, data string) {
+	t.Helper()
+
+	c.conn.SetWriteDeadline(time.Now().Add(testTimeout))
+
+	if _, err := c.conn.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testConn) Read(t *testing.T) *testResponse {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+
+	response, err := http.ReadResponse(c.reader, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testResponse{StatusCode: response.StatusCode, Header: response.Header, Body: body, Close: response.Close}
+}
+
+// ReadHead reads a response which has no body whatever its headers say, as
+// the response to HEAD, 204 and 304 have none.
+func (c *testConn) ReadHead(t *testing.T) *testResponse {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+
+	response, err := http.ReadResponse(c.reader, &http.Request{Method: "HEAD"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	return &testResponse{StatusCode: response.StatusCode, Header: response.Header, Close: response.Close}
+}
+
+// ExpectClosed waits until the server closes the connection, nothing may be sent before.
+func (c *testConn) ExpectClosed(t *testing.T) {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(testTimeout))
+
+	if data, err := c.reader.ReadByte(); err == nil {
+		t.Fatalf("unexpected data %q, expected the connection to be closed", data)
+	} else if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+		t.Fatal("connection is still open")
+	}
+}
+
+// Expect checks the status code, and for a non-nil body the JSON headers and the exact body.
+func (r *testResponse) Expect(t *testing.T, statusCode int, body []byte) {
+	t.Helper()
+
+	if r.StatusCode != statusCode {
+		t.Fatalf("status %d, expected %d, body %q", r.StatusCode, statusCode, r.Body)
+	}
+
+	if r.Header.Get("Content-Length") != strconv.Itoa(len(r.Body)) {
+		t.Fatalf("Content-Length %q, body has %d bytes", r.Header.Get("Content-Length"), len(r.Body))
+	}
+
+	if body == nil {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != jsonContentType {
+		t.Fatalf("Content-Type %q, expected %q", r.Header.Get("Content-Type"), jsonContentType)
+	}
+
+	if string(r.Body) != string(body) {
+		t.Fatalf("body %s, expected %s", r.Body, body)
+	}
+}
+
+func getRequest(uri string) string {
+	return "GET " + uri + " HTTP/1.1\r\nHost: travels.com\r\nConnection: keep-alive\r\n\r\n"
+}
+
+func postRequest(uri string, body string) string {
+	return "POST " + uri + " HTTP/1.1\r\nHost: travels.com\r\nConnection: keep-alive\r\n" +
+		"Content-Type: application/json\r\nContent-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n" + body
+}
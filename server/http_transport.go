@@ -0,0 +1,103 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+type HttpTransport struct {
+	server *http.Server
+}
+
+func (t *HttpTransport) Serve(s *Server, port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+
+	if err != nil {
+		return err
+	}
+
+	t.server = &http.Server{
+		IdleTimeout:       s.IdleTimeout,
+		ReadHeaderTimeout: s.HeaderTimeout,
+		MaxHeaderBytes:    s.MaxHeaderSize,
+	}
+
+	t.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := s.acquireResponse()
+
+		if s.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(s.MaxBodySize))
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			if _, isTooLarge := err.(*http.MaxBytesError); isTooLarge {
+				response.WriteError(413, nil)
+			} else {
+				response.WriteError(400, nil)
+			}
+
+			writeHttpResponse(w, response)
+			s.releaseResponse(response)
+			return
+		}
+
+		request, statusCode := s.prepareRequest([]byte(r.Method), []byte(r.URL.Path), []byte(r.URL.RawQuery), body)
+		request.AcceptEncoding = []byte(r.Header.Get("Accept-Encoding"))
+		request.IfNoneMatch = []byte(r.Header.Get("If-None-Match"))
+		request.IfMatch = []byte(r.Header.Get("If-Match"))
+		request.Origin = []byte(r.Header.Get("Origin"))
+
+		s.serve(request, statusCode, response)
+		writeHttpResponse(w, response)
+
+		s.releaseResponse(response)
+		s.releaseRequest(request)
+	})
+
+	s.serving(listener.Addr())
+
+	if err := t.server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (t *HttpTransport) Shutdown() error {
+	return t.server.Close()
+}
+
+// writeHttpResponse sends a streamed body chunked, as net/http does for a
+// body of unknown length.
+func writeHttpResponse(w http.ResponseWriter, response *Response) {
+	if response.HasBody() {
+		w.Header().Set("Content-Type", response.ContentType())
+	}
+
+	if response.HasBody() && response.Stream == nil {
+		w.Header().Set("Content-Length", strconv.Itoa(len(response.Body)))
+	}
+
+	response.headers = response.appendHeaders(response.headers[:0])
+
+	forEachHeader(response.headers, func(name []byte, value []byte) {
+		w.Header().Set(string(name), string(value))
+	})
+
+	w.WriteHeader(response.StatusCode)
+
+	if response.IsHead {
+		return
+	}
+
+	if response.Stream == nil {
+		w.Write(response.Body)
+	} else if err := response.Stream(w); err != nil {
+		// Aborting drops the connection, so the client does not take a cut body for a whole one.
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,402 @@
+package server
+
+import (
+	"bytes"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/exporter"
+	"github.com/valyala/fasthttp"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const jsonContentType = "application/json"
+const textContentType = "text/plain"
+const zipContentType = "application/zip"
+const csvContentType = "text/csv; charset=utf-8"
+
+type Response struct {
+	StatusCode  int
+	Body        []byte
+	ErrorFormat ErrorFormat
+	// Close makes AppendHTTP announce that the connection ends after this response.
+	Close bool
+	// ContentEncoding is set once Server.compress has encoded Body.
+	ContentEncoding string
+	// Version of the entity behind the body, sent as the ETag when not zero.
+	Version uint64
+	// Allow lists the methods of the route on 405 and OPTIONS responses.
+	Allow string
+	// AllowOrigin is the Access-Control-Allow-Origin value, see Server.CORSOrigins.
+	AllowOrigin string
+	// IsHead keeps the headers of the body, Content-Length included, but drops the body.
+	IsHead bool
+	// MediaType replaces the JSON content type of a 200 body which is not JSON.
+	MediaType string
+	// Stream writes a body too large to buffer straight to the connection, Body
+	// stays empty. The body has no Content-Length, see Server.serveRaw.
+	Stream  func(w io.Writer) error
+	encoded []byte
+	headers []byte
+}
+
+func (r *Response) ContentType() string {
+	if r.StatusCode == 200 && r.MediaType != "" {
+		return r.MediaType
+	}
+
+	if r.StatusCode == 200 || r.ErrorFormat == JSONErrors {
+		return jsonContentType
+	}
+
+	return textContentType
+}
+
+func (r *Response) Reset() {
+	r.StatusCode = 0
+	r.Close = false
+	r.ContentEncoding = ""
+	r.Version = 0
+	r.Allow = ""
+	r.AllowOrigin = ""
+	r.IsHead = false
+	r.MediaType = ""
+	r.Stream = nil
+	r.Body = r.Body[:0]
+}
+
+func (r *Response) WriteNotFound() {
+	r.WriteError(404, nil)
+}
+
+func (r *Response) WriteBadRequest() {
+	r.WriteError(400, nil)
+}
+
+// WriteError builds every error response. err is only shown by JSONErrors,
+// a *RequestError adds the field at fault.
+func (r *Response) WriteError(statusCode int, err error) {
+	r.StatusCode = statusCode
+	r.Version = 0
+	r.Body = r.Body[:0]
+
+	switch r.ErrorFormat {
+	case TextErrors:
+		r.Body = append(r.Body, http.StatusText(statusCode)...)
+	case JSONErrors:
+		r.Body = append(r.Body, '{')
+		r.Body = appendErrorFields(r.Body, statusCode, err)
+		r.Body = append(r.Body, '}')
+	}
+}
+
+// appendErrorFields appends the "error" and "field" members of a JSON error.
+func appendErrorFields(out []byte, statusCode int, err error) []byte {
+	message, field := http.StatusText(statusCode), ""
+
+	if requestError, isRequestError := err.(*RequestError); isRequestError {
+		message, field = requestError.Message, requestError.Field
+	} else if err != nil {
+		message = err.Error()
+	}
+
+	out = append(out, `"error": `...)
+	out = db.AppendJSONString(out, message)
+
+	if field != "" {
+		out = append(out, `, "field": `...)
+		out = db.AppendJSONString(out, field)
+	}
+
+	return out
+}
+
+// WriteNotModified answers a conditional GET whose tag still matches version.
+func (r *Response) WriteNotModified(version uint64) {
+	r.StatusCode = 304
+	r.Version = version
+	r.Body = r.Body[:0]
+}
+
+// WriteOptions answers OPTIONS with the methods of the route.
+func (r *Response) WriteOptions(allow string) {
+	r.StatusCode = 204
+	r.Allow = allow
+	r.Body = r.Body[:0]
+}
+
+func (r *Response) WriteEmpty() {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{}`...)
+}
+
+func (r *Response) WriteMutationResult(err error) {
+	if err == nil {
+		r.WriteEmpty()
+		return
+	}
+
+	r.WriteError(mutationStatus(err))
+}
+
+// mutationStatus maps a database error to the status and the error shown.
+func mutationStatus(err error) (int, error) {
+	switch err {
+	case nil:
+		return 200, nil
+	case db.ErrNotFound:
+		return 404, err
+	case db.ErrAlreadyExists:
+		return 400, fieldError("id", err.Error())
+	case db.ErrPreconditionFailed:
+		return 412, err
+	case db.ErrHasVisits, db.ErrDeletedOwner, db.ErrRolledBack, db.ErrNotApplied:
+		return 409, err
+	}
+
+	return 400, err
+}
+
+func (r *Response) WriteUser(user *db.User) {
+	r.StatusCode = 200
+	r.Version = user.Version
+	r.Body = user.Serialize(r.Body[:0])
+}
+
+func (r *Response) WriteLocation(location *db.Location) {
+	r.StatusCode = 200
+	r.Version = location.Version
+	r.Body = location.Serialize(r.Body[:0])
+}
+
+func (r *Response) WriteVisit(visit *db.Visit) {
+	r.StatusCode = 200
+	r.Version = visit.Version
+	r.Body = visit.Serialize(r.Body[:0])
+}
+
+func (r *Response) WriteVisitedPlaces(visits []*db.Visit) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"visits": [`...)
+
+	for index, visit := range visits {
+		if index != 0 {
+			r.Body = append(r.Body, ',')
+		}
+
+		r.Body = visit.SerializeVisited(r.Body)
+	}
+
+	r.Body = append(r.Body, `]}`...)
+}
+
+func (r *Response) WriteAvgMark(avgMark db.AvgMark) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"avg": `...)
+
+	if avgMark.CountVisits == 0 {
+		r.Body = append(r.Body, '0')
+	} else {
+		r.Body = strconv.AppendFloat(r.Body, avgMark.Value, 'f', 6, 32)
+	}
+
+	r.Body = append(r.Body, '}')
+}
+
+func (r *Response) WriteTombstones(tombstones []db.Tombstone) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"tombstones": [`...)
+
+	for index, tombstone := range tombstones {
+		if index != 0 {
+			r.Body = append(r.Body, ',')
+		}
+
+		r.Body = append(r.Body, `{"entity":"`...)
+		r.Body = append(r.Body, tombstone.Entity...)
+		r.Body = append(r.Body, `","id":`...)
+		r.Body = strconv.AppendInt(r.Body, int64(tombstone.Id), 10)
+		r.Body = append(r.Body, `,"deleted_at":`...)
+		r.Body = strconv.AppendInt(r.Body, tombstone.DeletedAt, 10)
+		r.Body = append(r.Body, '}')
+	}
+
+	r.Body = append(r.Body, `]}`...)
+}
+
+// WriteBatchResults answers POST /batch with the status of every line, errors
+// are always JSON there since they are part of a 200 body.
+func (r *Response) WriteBatchResults(lines []int, errs []error) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"results": [`...)
+
+	for index, err := range errs {
+		if index != 0 {
+			r.Body = append(r.Body, ',')
+		}
+
+		statusCode, err := mutationStatus(err)
+
+		r.Body = append(r.Body, `{"line": `...)
+		r.Body = strconv.AppendInt(r.Body, int64(lines[index]), 10)
+		r.Body = append(r.Body, `, "status": `...)
+		r.Body = strconv.AppendInt(r.Body, int64(statusCode), 10)
+
+		if err != nil {
+			r.Body = append(r.Body, ", "...)
+			r.Body = appendErrorFields(r.Body, statusCode, err)
+		}
+
+		r.Body = append(r.Body, '}')
+	}
+
+	r.Body = append(r.Body, `]}`...)
+}
+
+func (r *Response) WritePurged(count int) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"purged": `...)
+	r.Body = strconv.AppendInt(r.Body, int64(count), 10)
+	r.Body = append(r.Body, '}')
+}
+
+func (r *Response) WriteExportFiles(files []exporter.File) {
+	r.StatusCode = 200
+	r.Body = append(r.Body[:0], `{"files": [`...)
+
+	for index, file := range files {
+		if index != 0 {
+			r.Body = append(r.Body, ',')
+		}
+
+		r.Body = db.AppendJSONString(r.Body, file.Name())
+	}
+
+	r.Body = append(r.Body, `]}`...)
+}
+
+func (r *Response) WriteExportFile(database *db.DataBase, file exporter.File, entitiesPerFile int) {
+	r.StatusCode = 200
+	r.Body = exporter.AppendFile(r.Body[:0], database, file, entitiesPerFile)
+}
+
+// WriteExportZip and WriteExportCSV stream the whole dataset, the exporter
+// takes the read lock for one file at a time while it is sent.
+func (r *Response) WriteExportZip(database *db.DataBase, entitiesPerFile int) {
+	r.StatusCode = 200
+	r.MediaType = zipContentType
+	r.Body = r.Body[:0]
+	r.Stream = func(w io.Writer) error { return exporter.WriteZip(w, database, entitiesPerFile) }
+}
+
+func (r *Response) WriteExportCSV(database *db.DataBase, entity string) {
+	r.StatusCode = 200
+	r.MediaType = csvContentType
+	r.Body = r.Body[:0]
+	r.Stream = func(w io.Writer) error { return exporter.WriteCSV(w, database, entity) }
+}
+
+func (r *Response) WriteExportOptions(database *db.DataBase) {
+	r.StatusCode = 200
+	r.MediaType = textContentType
+	r.Body = exporter.AppendOptions(r.Body[:0], database)
+}
+
+// AppendHTTP encodes the response as a raw HTTP/1.1 message for transports
+// which write straight to the socket.
+func (r *Response) AppendHTTP(out []byte) []byte {
+	out = append(out, "HTTP/1.1 "...)
+	out = fasthttp.AppendUint(out, r.StatusCode)
+	out = append(out, ' ')
+	out = append(out, http.StatusText(r.StatusCode)...)
+
+	if r.HasBody() && r.Stream == nil {
+		out = append(out, "\nContent-Length: "...)
+		out = fasthttp.AppendUint(out, len(r.Body))
+	}
+
+	if r.HasBody() {
+		out = append(out, "\nContent-Type: "...)
+		out = append(out, r.ContentType()...)
+	}
+
+	out = r.appendHeaders(out)
+
+	if r.Close {
+		out = append(out, "\nConnection: close\n\n"...)
+	} else {
+		out = append(out, "\nConnection: Keep-Alive\n\n"...)
+	}
+
+	if r.IsHead {
+		return out
+	}
+
+	return append(out, r.Body...)
+}
+
+// HasBody is false for statuses which describe a body without sending one,
+// they have no Content-Length and Content-Type of their own.
+func (r *Response) HasBody() bool {
+	return r.StatusCode != 204 && r.StatusCode != 304
+}
+
+// appendHeaders appends the optional headers as "\nName: value" lines, the
+// transports with their own header API replay them with forEachHeader.
+func (r *Response) appendHeaders(out []byte) []byte {
+	if r.Version != 0 {
+		out = append(out, "\nETag: "...)
+		out = appendETag(out, r.Version, r.ContentEncoding)
+	}
+
+	if r.ContentEncoding != "" {
+		out = append(out, "\nContent-Encoding: "...)
+		out = append(out, r.ContentEncoding...)
+	}
+
+	if r.ContentEncoding != "" && r.AllowOrigin != "" && r.AllowOrigin != "*" {
+		out = append(out, "\nVary: Accept-Encoding, Origin"...)
+	} else if r.ContentEncoding != "" {
+		out = append(out, "\nVary: Accept-Encoding"...)
+	} else if r.AllowOrigin != "" && r.AllowOrigin != "*" {
+		out = append(out, "\nVary: Origin"...)
+	}
+
+	if r.Allow != "" {
+		out = append(out, "\nAllow: "...)
+		out = append(out, r.Allow...)
+	}
+
+	if r.AllowOrigin != "" {
+		out = append(out, "\nAccess-Control-Allow-Origin: "...)
+		out = append(out, r.AllowOrigin...)
+		out = append(out, "\nAccess-Control-Expose-Headers: "+corsExposedHeaders...)
+	}
+
+	if r.AllowOrigin != "" && r.StatusCode == 204 && r.Allow != "" {
+		out = append(out, "\nAccess-Control-Allow-Methods: "...)
+		out = append(out, r.Allow...)
+		out = append(out, "\nAccess-Control-Allow-Headers: "+corsAllowedHeaders...)
+		out = append(out, "\nAccess-Control-Max-Age: "+corsMaxAge...)
+	}
+
+	return out
+}
+
+// forEachHeader calls set for every line appendHeaders produced.
+func forEachHeader(headers []byte, set func(name []byte, value []byte)) {
+	for len(headers) > 0 {
+		headers = headers[1:]
+		line := headers
+
+		if index := bytes.IndexByte(headers, '\n'); index != -1 {
+			line, headers = headers[:index], headers[index:]
+		} else {
+			headers = nil
+		}
+
+		if index := bytes.Index(line, []byte(": ")); index != -1 {
+			set(line[:index], line[index+2:])
+		}
+	}
+}
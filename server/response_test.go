@@ -0,0 +1,147 @@
+package server
+
+import (
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"testing"
+)
+
+func TestResponse_WriteVisitedPlaces(t *testing.T) {
+	location := &db.Location{Id: 1, Place: "Park"}
+
+	visits := []*db.Visit{
+		{Id: 1, Location: location, Mark: 4, VisitedAt: 1000000000},
+		{Id: 2, Location: location, Mark: 2, VisitedAt: 1100000000},
+	}
+
+	response := new(Response)
+
+	response.WriteVisitedPlaces(nil)
+
+	if string(response.Body) != `{"visits": []}` {
+		t.Errorf("unexpected body for empty visits: %s", response.Body)
+	}
+
+	response.WriteVisitedPlaces(visits)
+
+	expected := `{"visits": [{"mark":4,"visited_at":1000000000,"place":"Park"},{"mark":2,"visited_at":1100000000,"place":"Park"}]}`
+
+	if response.StatusCode != 200 || string(response.Body) != expected {
+		t.Errorf("unexpected response %d %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestResponse_WriteAvgMark(t *testing.T) {
+	response := new(Response)
+
+	response.WriteAvgMark(db.AvgMark{})
+
+	if string(response.Body) != `{"avg": 0}` {
+		t.Errorf("unexpected body for empty avg: %s", response.Body)
+	}
+
+	response.WriteAvgMark(db.AvgMark{Value: 3.33333, CountVisits: 3})
+
+	if string(response.Body) != `{"avg": 3.333330}` {
+		t.Errorf("unexpected body for avg: %s", response.Body)
+	}
+}
+
+func TestResponse_AppendHTTP(t *testing.T) {
+	response := new(Response)
+
+	response.WriteNotFound()
+
+	expectedNotFound := "HTTP/1.1 404 Not Found\nContent-Length: 9\nContent-Type: text/plain\nConnection: Keep-Alive\n\nNot Found"
+
+	if string(response.AppendHTTP(nil)) != expectedNotFound {
+		t.Errorf("unexpected not found response: %s", response.AppendHTTP(nil))
+	}
+
+	response.WriteAvgMark(db.AvgMark{})
+
+	expected := "HTTP/1.1 200 OK\nContent-Length: 10\nContent-Type: application/json\nConnection: Keep-Alive\n\n{\"avg\": 0}"
+
+	if string(response.AppendHTTP(nil)) != expected {
+		t.Errorf("unexpected response: %s", response.AppendHTTP(nil))
+	}
+
+	response.WriteOptions(entityMethods)
+	response.AllowOrigin = "https://dashboard.example.com"
+
+	expectedOptions := "HTTP/1.1 204 No Content\nVary: Origin\nAllow: GET, HEAD, POST, DELETE, OPTIONS" +
+		"\nAccess-Control-Allow-Origin: https://dashboard.example.com\nAccess-Control-Expose-Headers: ETag" +
+		"\nAccess-Control-Allow-Methods: GET, HEAD, POST, DELETE, OPTIONS\nAccess-Control-Allow-Headers: Content-Type, If-Match, If-None-Match" +
+		"\nAccess-Control-Max-Age: 600\nConnection: Keep-Alive\n\n"
+
+	if string(response.AppendHTTP(nil)) != expectedOptions {
+		t.Errorf("unexpected options response: %s", response.AppendHTTP(nil))
+	}
+
+	var replayed []string
+
+	forEachHeader(response.appendHeaders(nil), func(name []byte, value []byte) {
+		replayed = append(replayed, string(name)+"="+string(value))
+	})
+
+	if len(replayed) != 7 || replayed[0] != "Vary=Origin" || replayed[6] != "Access-Control-Max-Age=600" {
+		t.Errorf("unexpected replayed headers %q", replayed)
+	}
+
+	response.Reset()
+	response.WriteAvgMark(db.AvgMark{})
+	response.IsHead = true
+
+	expectedHead := "HTTP/1.1 200 OK\nContent-Length: 10\nContent-Type: application/json\nConnection: Keep-Alive\n\n"
+
+	if string(response.AppendHTTP(nil)) != expectedHead {
+		t.Errorf("unexpected head response: %s", response.AppendHTTP(nil))
+	}
+
+	response.Reset()
+	response.WriteNotModified(42)
+
+	expectedNotModified := "HTTP/1.1 304 Not Modified\nETag: \"42\"\nConnection: Keep-Alive\n\n"
+
+	if string(response.AppendHTTP(nil)) != expectedNotModified {
+		t.Errorf("unexpected not modified response: %s", response.AppendHTTP(nil))
+	}
+}
+
+func TestResponse_WriteError(t *testing.T) {
+	tests := []struct {
+		format     ErrorFormat
+		statusCode int
+		err        error
+		http       string
+	}{
+		{TextErrors, 400, fieldError("toDate", "must be an integer"),
+			"HTTP/1.1 400 Bad Request\nContent-Length: 11\nContent-Type: text/plain\nConnection: Keep-Alive\n\nBad Request"},
+		{EmptyErrors, 404, nil,
+			"HTTP/1.1 404 Not Found\nContent-Length: 0\nContent-Type: text/plain\nConnection: Keep-Alive\n\n"},
+		{JSONErrors, 400, fieldError("toDate", "must be an integer"),
+			"HTTP/1.1 400 Bad Request\nContent-Length: 50\nContent-Type: application/json\nConnection: Keep-Alive\n\n" +
+				`{"error": "must be an integer", "field": "toDate"}`},
+		{JSONErrors, 404, db.ErrNotFound,
+			"HTTP/1.1 404 Not Found\nContent-Length: 29\nContent-Type: application/json\nConnection: Keep-Alive\n\n" +
+				`{"error": "entity not found"}`},
+		{JSONErrors, 405, nil,
+			"HTTP/1.1 405 Method Not Allowed\nContent-Length: 31\nContent-Type: application/json\nConnection: Keep-Alive\n\n" +
+				`{"error": "Method Not Allowed"}`},
+		{TextErrors, 413, nil,
+			"HTTP/1.1 413 Request Entity Too Large\nContent-Length: 24\nContent-Type: text/plain\nConnection: Keep-Alive\n\nRequest Entity Too Large"},
+		{TextErrors, 500, nil,
+			"HTTP/1.1 500 Internal Server Error\nContent-Length: 21\nContent-Type: text/plain\nConnection: Keep-Alive\n\nInternal Server Error"},
+		{JSONErrors, 503, &RequestError{Message: "say \"hi\"\n"},
+			"HTTP/1.1 503 Service Unavailable\nContent-Length: 29\nContent-Type: application/json\nConnection: Keep-Alive\n\n" +
+				`{"error": "say \"hi\"\u000a"}`},
+	}
+
+	for _, test := range tests {
+		response := &Response{ErrorFormat: test.format}
+		response.WriteError(test.statusCode, test.err)
+
+		if string(response.AppendHTTP(nil)) != test.http {
+			t.Errorf("format %d, status %d: unexpected response %q", test.format, test.statusCode, response.AppendHTTP(nil))
+		}
+	}
+}
@@ -0,0 +1,1075 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ArtyomNorin/hlc2017_go/db"
+	"github.com/ArtyomNorin/hlc2017_go/exporter"
+	"github.com/tidwall/evio"
+	"github.com/valyala/fasthttp"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const GetUserMethod = 1
+const GetLocationMethod = 2
+const GetVisitMethod = 3
+
+const GetVisitedPlacesMethod = 4
+const GetAvgMarkMethod = 5
+
+const UpdateUserMethod = 6
+const UpdateLocationMethod = 7
+const UpdateVisitMethod = 8
+
+const CreateUserMethod = 9
+const CreateLocationMethod = 10
+const CreateVisitMethod = 11
+
+var GetUserRoute = []byte("/users/<id>")
+var GetLocationRoute = []byte("/locations/<id>")
+var GetVisitRoute = []byte("/visits/<id>")
+
+var GetVisitedPlacesRoute = []byte("/users/<id>/visits")
+var GetAvgMarkRoute = []byte("/locations/<id>/avg")
+
+var CreateUserRoute = []byte("/users/new")
+var CreateLocationRoute = []byte("/locations/new")
+var CreateVisitRoute = []byte("/visits/new")
+
+var RestoreUserRoute = []byte("/users/<id>/restore")
+var RestoreLocationRoute = []byte("/locations/<id>/restore")
+var RestoreVisitRoute = []byte("/visits/<id>/restore")
+
+var BatchRoute = []byte("/batch")
+var TransactionRoute = []byte("/transactions")
+
+// AdminRoute prefixes the routes served only with Server.Admin.
+var AdminRoute = []byte("/admin/")
+
+var TombstonesRoute = []byte("/admin/tombstones")
+var PurgeTombstonesRoute = []byte("/admin/tombstones/purge")
+
+var ExportRoute = []byte("/admin/export")
+var ExportUsersRoute = []byte("/admin/export/users_<id>.json")
+var ExportLocationsRoute = []byte("/admin/export/locations_<id>.json")
+var ExportVisitsRoute = []byte("/admin/export/visits_<id>.json")
+var ExportZipRoute = []byte("/admin/export/data.zip")
+var ExportOptionsRoute = []byte("/admin/export/options.txt")
+var ExportUsersCSVRoute = []byte("/admin/export/users.csv")
+var ExportLocationsCSVRoute = []byte("/admin/export/locations.csv")
+var ExportVisitsCSVRoute = []byte("/admin/export/visits.csv")
+
+var GetRequest = []byte("GET")
+var PostRequest = []byte("POST")
+var HeadRequest = []byte("HEAD")
+var OptionsRequest = []byte("OPTIONS")
+var DeleteRequest = []byte("DELETE")
+
+// Methods of each kind of route, sent in Allow headers and CORS preflights.
+const entityMethods = "GET, HEAD, POST, DELETE, OPTIONS"
+const queryMethods = "GET, HEAD, OPTIONS"
+const postMethods = "POST, OPTIONS"
+
+var IdReplacer = []byte("<id>")
+/*var UsersRoutePart = []byte("users")
+var VisitsRoutePart = []byte("visits")
+var LocationsRoutePart = []byte("locations")
+var AvgRoutePart = []byte("avg")
+var NewRoutePart = []byte("new")
+
+var queryParamsDelimiter = []byte("&")
+var queryKeyValueDelimiter = []byte("=")*/
+
+type Server struct {
+	RequestPool         sync.Pool
+	DataBase            *db.DataBase
+	UsersCache          map[string][]byte
+	UsersCacheMutex     *sync.Mutex
+	LocationsCache      map[string][]byte
+	LocationsCacheMutex *sync.Mutex
+	ResponsePool        sync.Pool
+	VisitsPool          sync.Pool
+	TombstonesPool      sync.Pool
+	Transport           Transport
+	Recorder            Recorder
+	ErrorFormat         ErrorFormat
+	// IdleTimeout closes keep-alive connections without requests for that long, zero keeps them.
+	IdleTimeout time.Duration
+	// HeaderTimeout drops connections which take longer to send the headers of a request.
+	HeaderTimeout time.Duration
+	// MaxHeaderSize and MaxBodySize are answered with 431 and 413. MaxBufferedBytes
+	// bounds the unanswered bytes a raw connection may hold. Zero disables a limit.
+	MaxHeaderSize    int
+	MaxBodySize      int
+	MaxBufferedBytes int
+	// CompressMinSize is the smallest body sent with gzip or deflate when the client accepts it, zero disables.
+	CompressMinSize int
+	// CORSOrigins may call the API from a browser, "*" allows any origin. Empty disables CORS.
+	CORSOrigins []string
+	// DeletePolicy applies to users and locations deleted while they have visits.
+	DeletePolicy db.DeletePolicy
+	// SoftDelete keeps deleted entities as tombstones, restorable until purged.
+	SoftDelete bool
+	// Admin serves the /admin routes, which have no authentication, so they answer 404 by default.
+	Admin bool
+	// ExportEntitiesPerFile is the most entities in one file of /admin/export.
+	ExportEntitiesPerFile int
+	// Serving is called once the transport listens, with the actual address.
+	Serving func(addr net.Addr)
+}
+
+// Recorder receives every raw chunk read by the evio transport, see capture.Writer.
+type Recorder interface {
+	Record(connectionId uint64, data []byte) error
+}
+
+func NewServer(database *db.DataBase) *Server {
+	server := new(Server)
+
+	server.RequestPool = sync.Pool{
+		New: func() interface{} { return &Request{Query: make(map[string]string, 5)} },
+	}
+
+	server.ResponsePool = sync.Pool{
+		New: func() interface{} { return &Response{Body: make([]byte, 0, 4096)} },
+	}
+
+	server.VisitsPool = sync.Pool{
+		New: func() interface{} { return make([]*db.Visit, 0, 64) },
+	}
+
+	server.TombstonesPool = sync.Pool{
+		New: func() interface{} { return make([]db.Tombstone, 0, 64) },
+	}
+
+	server.DataBase = database
+	server.Transport = new(EvioTransport)
+
+	server.HeaderTimeout = DefaultHeaderTimeout
+	server.MaxHeaderSize = DefaultMaxHeaderSize
+	server.MaxBodySize = DefaultMaxBodySize
+	server.MaxBufferedBytes = DefaultMaxBufferedBytes
+	server.CompressMinSize = DefaultCompressMinSize
+	server.ExportEntitiesPerFile = exporter.DefaultEntitiesPerFile
+
+	server.LocationsCacheMutex = new(sync.Mutex)
+	server.UsersCacheMutex = new(sync.Mutex)
+
+	if database.IsTrain {
+		server.UsersCache = make(map[string][]byte, 1782)
+		server.LocationsCache = make(map[string][]byte, 1846)
+	} else {
+		server.UsersCache = make(map[string][]byte, 30044)
+		server.LocationsCache = make(map[string][]byte, 29775)
+	}
+
+	return server
+}
+
+const DefaultHeaderTimeout = 10 * time.Second
+const DefaultMaxHeaderSize = 8 << 10
+const DefaultMaxBodySize = 1 << 20
+const DefaultMaxBufferedBytes = 2 << 20
+const DefaultCompressMinSize = 1 << 10
+
+type RequestContext struct {
+	Id          uint64
+	InputStream evio.InputStream
+	Out         [4096]byte
+	// lastActiveAt and headerStartedAt are in unix nanoseconds, the timeout
+	// check reads them from another loop. headerStartedAt is zero unless the
+	// headers of a request are still incomplete.
+	lastActiveAt    int64
+	headerStartedAt int64
+	// stream is the streamed body the connection is detached for.
+	stream func(w io.Writer) error
+}
+
+/*type HttpRequest struct {
+	Route    uint8
+	Query    map[string]string
+	Body     []byte
+	EntityId int
+}*/
+
+type Request struct {
+	Method   []byte
+	Path     []byte
+	CacheKey string
+	Query    map[string]string
+	Body     []byte
+	EntityId int
+	// Close is set by the raw parser when the connection ends after the response.
+	Close bool
+	// AcceptEncoding, IfNoneMatch, IfMatch and Origin are raw headers, set by the transport.
+	AcceptEncoding []byte
+	IfNoneMatch    []byte
+	IfMatch        []byte
+	Origin         []byte
+	// IsHead is a HEAD request, handled as a GET whose body is not sent.
+	IsHead bool
+}
+
+func (s *Server) SaveUserToCache(request *Request, response []byte) {
+	_, isFound := s.GetUserFromCache(request)
+
+	if !isFound {
+		s.UsersCacheMutex.Lock()
+		s.UsersCache[request.CacheKey] = response
+		s.UsersCacheMutex.Unlock()
+	}
+}
+
+func (s *Server) GetUserFromCache(request *Request) (response []byte, isFound bool) {
+	response, isFound = s.UsersCache[request.CacheKey]
+	return
+}
+
+func (s *Server) SaveLocationToCache(request *Request, response []byte) {
+	_, isFound := s.GetLocationFromCache(request)
+
+	if !isFound {
+		s.LocationsCacheMutex.Lock()
+		s.LocationsCache[request.CacheKey] = response
+		s.LocationsCacheMutex.Unlock()
+	}
+}
+
+func (s *Server) GetLocationFromCache(request *Request) (response []byte, isFound bool) {
+	response, isFound = s.LocationsCache[request.CacheKey]
+	return
+}
+
+func (s *Server) Run(port int) {
+	if err := s.Transport.Serve(s, port); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func (s *Server) Shutdown() error {
+	return s.Transport.Shutdown()
+}
+
+func (s *Server) serving(addr net.Addr) {
+	log.Println(fmt.Sprintf("Server is listening on %s", addr))
+
+	if s.Serving != nil {
+		s.Serving(addr)
+	}
+}
+
+func (s *Server) Handle(request *Request, statusCode int, response *Response) {
+	if !s.Admin && bytes.HasPrefix(request.Path, AdminRoute) {
+		response.WriteNotFound()
+		return
+	}
+
+	if statusCode != 200 {
+		response.WriteError(statusCode, nil)
+
+		if statusCode == 405 {
+			response.Allow = routeMethods(request.Path)
+		}
+
+		return
+	}
+
+	if bytes.Equal(request.Method, OptionsRequest) {
+		response.WriteOptions(routeMethods(request.Path))
+		return
+	}
+
+	if bytes.Equal(request.Method, GetRequest) {
+		// Entities are serialized straight from the database, so the read lock
+		// is held until the response is written.
+		s.DataBase.RLock()
+		defer s.DataBase.RUnlock()
+	}
+
+	if bytes.Equal(request.Path, GetUserRoute) && bytes.Equal(request.Method, GetRequest) {
+		user, isFound := s.DataBase.GetUser(request.EntityId)
+
+		if !isFound {
+			response.WriteNotFound()
+			return
+		}
+
+		if isETagMatched(request.IfNoneMatch, user.Version) {
+			response.WriteNotModified(user.Version)
+			return
+		}
+
+		response.WriteUser(user)
+		/*response, isFound := s.GetUserFromCache(request)
+
+		if isFound {
+			out = response
+		} else {
+			out = s.DataBase.GetUser(request.EntityId, out)
+			s.SaveUserToCache(request, out)
+		}*/
+
+	} else if bytes.Equal(request.Path, GetLocationRoute) && bytes.Equal(request.Method, GetRequest) {
+		location, isFound := s.DataBase.GetLocation(request.EntityId)
+
+		if !isFound {
+			response.WriteNotFound()
+			return
+		}
+
+		if isETagMatched(request.IfNoneMatch, location.Version) {
+			response.WriteNotModified(location.Version)
+			return
+		}
+
+		response.WriteLocation(location)
+		/*response, isFound := s.GetLocationFromCache(request)
+
+		if isFound {
+			out = response
+		} else {
+			out = s.DataBase.GetLocation(request.EntityId, out)
+			s.SaveLocationToCache(request, out)
+		}*/
+
+	} else if bytes.Equal(request.Path, GetVisitRoute) && bytes.Equal(request.Method, GetRequest) {
+		visit, isFound := s.DataBase.GetVisit(request.EntityId)
+
+		if !isFound {
+			response.WriteNotFound()
+			return
+		}
+
+		if isETagMatched(request.IfNoneMatch, visit.Version) {
+			response.WriteNotModified(visit.Version)
+			return
+		}
+
+		response.WriteVisit(visit)
+
+	} else if bytes.Equal(request.Path, GetVisitedPlacesRoute) && bytes.Equal(request.Method, GetRequest) {
+		var filter db.VisitedPlacesFilter
+
+		user, isFound := s.DataBase.GetUser(request.EntityId)
+
+		if !isFound {
+			response.WriteNotFound()
+			return
+		}
+
+		if err := parseVisitedPlacesFilter(request.Query, &filter); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		// The user version also follows its visits and their locations.
+		if isETagMatched(request.IfNoneMatch, user.Version) {
+			response.WriteNotModified(user.Version)
+			return
+		}
+
+		visits := s.VisitsPool.Get().([]*db.Visit)
+		visits, _ = s.DataBase.GetVisitedPlaces(request.EntityId, &filter, visits[:0])
+
+		response.WriteVisitedPlaces(visits)
+		response.Version = user.Version
+
+		s.VisitsPool.Put(visits[:0])
+
+	} else if bytes.Equal(request.Path, GetAvgMarkRoute) && bytes.Equal(request.Method, GetRequest) {
+		var filter db.AvgMarkFilter
+
+		location, isFound := s.DataBase.GetLocation(request.EntityId)
+
+		if !isFound {
+			response.WriteNotFound()
+			return
+		}
+
+		if err := parseAvgMarkFilter(request.Query, &filter); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		// The location version also follows its visits and their users.
+		if isETagMatched(request.IfNoneMatch, location.Version) {
+			response.WriteNotModified(location.Version)
+			return
+		}
+
+		avgMark, _ := s.DataBase.GetAvgMark(request.EntityId, &filter)
+
+		response.WriteAvgMark(avgMark)
+		response.Version = location.Version
+
+	} else if bytes.Equal(request.Path, CreateUserRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.UserFields
+
+		id, err := parseUserBody(request.Body, &fields)
+
+		if err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.CreateUser(id, &fields))
+
+	} else if bytes.Equal(request.Path, GetUserRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.UserFields
+
+		if !s.DataBase.IsUserExist(request.EntityId) {
+			response.WriteNotFound()
+			return
+		}
+
+		if _, err := parseUserBody(request.Body, &fields); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.UpdateUserIf(request.EntityId, &fields, ifMatch(request)))
+
+	} else if bytes.Equal(request.Path, CreateLocationRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.LocationFields
+
+		id, err := parseLocationBody(request.Body, &fields)
+
+		if err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.CreateLocation(id, &fields))
+
+	} else if bytes.Equal(request.Path, GetLocationRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.LocationFields
+
+		if !s.DataBase.IsLocationExist(request.EntityId) {
+			response.WriteNotFound()
+			return
+		}
+
+		if _, err := parseLocationBody(request.Body, &fields); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.UpdateLocationIf(request.EntityId, &fields, ifMatch(request)))
+
+	} else if bytes.Equal(request.Path, CreateVisitRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.VisitFields
+
+		id, err := parseVisitBody(request.Body, &fields)
+
+		if err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.CreateVisit(id, &fields))
+
+	} else if bytes.Equal(request.Path, GetVisitRoute) && bytes.Equal(request.Method, PostRequest) {
+		var fields db.VisitFields
+
+		if !s.DataBase.IsVisitExist(request.EntityId) {
+			response.WriteNotFound()
+			return
+		}
+
+		if _, err := parseVisitBody(request.Body, &fields); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WriteMutationResult(s.DataBase.UpdateVisitIf(request.EntityId, &fields, ifMatch(request)))
+
+	} else if bytes.Equal(request.Path, GetUserRoute) && bytes.Equal(request.Method, DeleteRequest) {
+		if s.SoftDelete {
+			response.WriteMutationResult(s.DataBase.SoftDeleteUser(request.EntityId, s.DeletePolicy, ifMatch(request)))
+		} else {
+			response.WriteMutationResult(s.DataBase.DeleteUser(request.EntityId, s.DeletePolicy, ifMatch(request)))
+		}
+
+	} else if bytes.Equal(request.Path, GetLocationRoute) && bytes.Equal(request.Method, DeleteRequest) {
+		if s.SoftDelete {
+			response.WriteMutationResult(s.DataBase.SoftDeleteLocation(request.EntityId, s.DeletePolicy, ifMatch(request)))
+		} else {
+			response.WriteMutationResult(s.DataBase.DeleteLocation(request.EntityId, s.DeletePolicy, ifMatch(request)))
+		}
+
+	} else if bytes.Equal(request.Path, GetVisitRoute) && bytes.Equal(request.Method, DeleteRequest) {
+		if s.SoftDelete {
+			response.WriteMutationResult(s.DataBase.SoftDeleteVisit(request.EntityId, ifMatch(request)))
+		} else {
+			response.WriteMutationResult(s.DataBase.DeleteVisit(request.EntityId, ifMatch(request)))
+		}
+
+	} else if bytes.Equal(request.Path, RestoreUserRoute) {
+		response.WriteMutationResult(s.DataBase.RestoreUser(request.EntityId))
+
+	} else if bytes.Equal(request.Path, RestoreLocationRoute) {
+		response.WriteMutationResult(s.DataBase.RestoreLocation(request.EntityId))
+
+	} else if bytes.Equal(request.Path, RestoreVisitRoute) {
+		response.WriteMutationResult(s.DataBase.RestoreVisit(request.EntityId))
+
+	} else if bytes.Equal(request.Path, BatchRoute) {
+		var isAtomic bool
+
+		if err := parseBoolParam(request.Query, "atomic", &isAtomic); err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		s.applyBatch(request.Body, isAtomic, response)
+
+	} else if bytes.Equal(request.Path, TransactionRoute) {
+		operations, paths, err := parseTransaction(request.Body)
+
+		if err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		index, err := s.DataBase.Transaction(operations)
+
+		if err != nil {
+			statusCode, err := mutationStatus(err)
+			response.WriteError(statusCode, prefixError(paths[index], err))
+			return
+		}
+
+		response.WriteEmpty()
+
+	} else if bytes.Equal(request.Path, ExportRoute) {
+		response.WriteExportFiles(exporter.Files(s.DataBase, s.ExportEntitiesPerFile))
+
+	} else if file, isExportFile := exportFile(request.Path, request.EntityId); isExportFile {
+		if !exporter.Exists(s.DataBase, file, s.ExportEntitiesPerFile) {
+			response.WriteNotFound()
+			return
+		}
+
+		response.WriteExportFile(s.DataBase, file, s.ExportEntitiesPerFile)
+
+	} else if bytes.Equal(request.Path, ExportZipRoute) {
+		response.WriteExportZip(s.DataBase, s.ExportEntitiesPerFile)
+
+	} else if bytes.Equal(request.Path, ExportOptionsRoute) {
+		response.WriteExportOptions(s.DataBase)
+
+	} else if entity := exportCSVEntity(request.Path); entity != "" {
+		response.WriteExportCSV(s.DataBase, entity)
+
+	} else if bytes.Equal(request.Path, TombstonesRoute) {
+		tombstones := s.TombstonesPool.Get().([]db.Tombstone)
+		tombstones = s.DataBase.Tombstones(tombstones[:0])
+
+		response.WriteTombstones(tombstones)
+
+		s.TombstonesPool.Put(tombstones[:0])
+
+	} else if bytes.Equal(request.Path, PurgeTombstonesRoute) {
+		before, err := parsePurgeBefore(request.Query)
+
+		if err != nil {
+			response.WriteError(400, err)
+			return
+		}
+
+		response.WritePurged(s.DataBase.Purge(before))
+
+	} else {
+		response.WriteNotFound()
+	}
+}
+
+// serve is Handle with the steps every transport applies to its result.
+func (s *Server) serve(request *Request, statusCode int, response *Response) {
+	s.Handle(request, statusCode, response)
+
+	response.IsHead = request.IsHead
+	response.AllowOrigin = s.allowOrigin(request.Origin)
+
+	s.compress(request, response)
+}
+
+// ServeRaw appends the response to one raw request to out. isClose tells the
+// transport to close the connection once out is written. A streamed body is
+// appended whole, the transports which stream it use serveRaw.
+func (s *Server) ServeRaw(data []byte, out []byte) (_ []byte, isClose bool) {
+	out, isClose, stream := s.serveRaw(data, out)
+
+	if stream != nil {
+		writer := appendWriter{out: out}
+		stream(&writer)
+		out = writer.out
+	}
+
+	return out, isClose
+}
+
+// serveRaw is ServeRaw which leaves a streamed body to the caller, out then
+// only holds the headers. Without a Content-Length the body ends with the
+// connection, so isClose is set.
+func (s *Server) serveRaw(data []byte, out []byte) (_ []byte, isClose bool, stream func(w io.Writer) error) {
+	request, statusCode := s.acquireRequest(data)
+	response := s.acquireResponse()
+
+	s.serve(request, statusCode, response)
+
+	if !response.IsHead {
+		stream = response.Stream
+	}
+
+	isClose = request.Close || stream != nil
+	response.Close = isClose
+	out = response.AppendHTTP(out)
+
+	s.releaseResponse(response)
+	s.releaseRequest(request)
+
+	return out, isClose, stream
+}
+
+// appendError answers a request which cannot be framed, the connection is closed after it.
+func (s *Server) appendError(out []byte, statusCode int) []byte {
+	response := s.acquireResponse()
+
+	response.WriteError(statusCode, nil)
+	response.Close = true
+	out = response.AppendHTTP(out)
+
+	s.releaseResponse(response)
+
+	return out
+}
+
+func (s *Server) acquireResponse() *Response {
+	response := s.ResponsePool.Get().(*Response)
+	response.ErrorFormat = s.ErrorFormat
+
+	return response
+}
+
+// maxPooledBodySize keeps the buffers of large responses like exports out of the pool.
+const maxPooledBodySize = 1 << 20
+
+func (s *Server) releaseResponse(response *Response) {
+	if cap(response.Body) > maxPooledBodySize || cap(response.encoded) > maxPooledBodySize {
+		return
+	}
+
+	response.Reset()
+	s.ResponsePool.Put(response)
+}
+
+/*func (s *Server) parseRequest(body []byte) (*HttpRequest, int) {
+	httpRequest := new(HttpRequest)
+	httpRequest.Query = make(map[string]string, 5)
+
+	isPost := false
+	leftIndex := 4
+	rightIndex := 0
+	var query []byte
+
+	if bytes.Equal(body[:4], PostRequest) {
+		isPost = true
+		leftIndex = 5
+	}
+
+	rightIndex = bytes.IndexByte(body[leftIndex:], '?')
+
+	if rightIndex == -1 {
+		rightIndex = bytes.IndexByte(body[leftIndex:], ' ')
+	} else {
+		query = body[rightIndex+leftIndex+1 : bytes.IndexByte(body[leftIndex:], ' ')+leftIndex]
+	}
+
+	path := body[leftIndex : rightIndex+leftIndex]
+
+	switch {
+	case bytes.Contains(path, UsersRoutePart) && bytes.Contains(path, VisitsRoutePart) && !isPost:
+		httpRequest.Route = GetVisitedPlacesMethod
+		entityId, err := fasthttp.ParseUint(path[7 : len(path)-7])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, LocationsRoutePart) && bytes.Contains(path, AvgRoutePart) && !isPost:
+		httpRequest.Route = GetAvgMarkMethod
+		entityId, err := fasthttp.ParseUint(path[11 : len(path)-4])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, UsersRoutePart) && bytes.Contains(path, NewRoutePart) && isPost:
+		httpRequest.Route = CreateUserMethod
+		break
+	case bytes.Contains(path, LocationsRoutePart) && bytes.Contains(path, NewRoutePart) && isPost:
+		httpRequest.Route = CreateLocationMethod
+		break
+	case bytes.Contains(path, VisitsRoutePart) && bytes.Contains(path, NewRoutePart) && isPost:
+		httpRequest.Route = CreateVisitMethod
+		break
+	case bytes.Contains(path, UsersRoutePart) && isPost:
+		httpRequest.Route = UpdateUserMethod
+		entityId, err := fasthttp.ParseUint(path[7:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, LocationsRoutePart) && isPost:
+		httpRequest.Route = UpdateLocationMethod
+		entityId, err := fasthttp.ParseUint(path[11:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, VisitsRoutePart) && isPost:
+		httpRequest.Route = UpdateVisitMethod
+		entityId, err := fasthttp.ParseUint(path[8:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, UsersRoutePart) && !isPost:
+		httpRequest.Route = GetUserMethod
+		entityId, err := fasthttp.ParseUint(path[7:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, LocationsRoutePart) && !isPost:
+		httpRequest.Route = GetLocationMethod
+		entityId, err := fasthttp.ParseUint(path[11:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	case bytes.Contains(path, VisitsRoutePart) && !isPost:
+		httpRequest.Route = GetVisitMethod
+		entityId, err := fasthttp.ParseUint(path[8:])
+
+		if err != nil {
+			return httpRequest, 404
+		}
+
+		httpRequest.EntityId = entityId
+		break
+	default:
+		return httpRequest, 404
+	}
+
+	if isPost {
+		leftIndex = bytes.IndexByte(body, '{')
+
+		if leftIndex == -1 {
+			return httpRequest, 400
+		}
+
+		httpRequest.Body = body[leftIndex:]
+	}
+
+	if query != nil {
+		leftIndex = 0
+
+		for {
+			rightIndex = bytes.IndexByte(query[leftIndex:], '=')
+
+			queryKey := query[leftIndex : rightIndex+leftIndex]
+			leftIndex += len(queryKey) + 1
+
+			rightIndex = bytes.IndexByte(query[leftIndex:], '&')
+
+			if rightIndex == -1 {
+				queryValue := query[leftIndex:]
+
+				httpRequest.Query[string(queryKey)] = string(queryValue)
+				break
+			} else {
+				queryValue := query[leftIndex : rightIndex+leftIndex]
+
+				httpRequest.Query[string(queryKey)] = string(queryValue)
+				leftIndex += len(queryValue) + 1
+			}
+		}
+	}
+
+	return httpRequest, 200
+}*/
+
+func (s *Server) acquireRequest(body []byte) (*Request, int) {
+	var query, requestBody, headers []byte
+
+	requestLine := body
+
+	if index := bytes.IndexByte(body, '\n'); index != -1 {
+		requestLine = body[:index]
+		headers = body[index+1:]
+	}
+
+	index := bytes.IndexByte(requestLine, ' ')
+
+	if index == -1 {
+		return s.acquireBadRequest()
+	}
+
+	method := requestLine[:index]
+	uri := requestLine[index+1:]
+
+	index = bytes.IndexByte(uri, ' ')
+
+	if index == -1 {
+		return s.acquireBadRequest()
+	}
+
+	protocol := bytes.TrimSpace(uri[index+1:])
+	uri = uri[:index]
+	path := uri
+
+	if index = bytes.IndexByte(uri, '?'); index != -1 {
+		path = uri[:index]
+		query = uri[index+1:]
+	}
+
+	// The body starts after the blank line, a '{' in a header value is not part of it.
+	if _, bodyStart := findHeadersEnd(body); bodyStart != 0 && bytes.Equal(method, PostRequest) {
+		requestBody = body[bodyStart:]
+	}
+
+	request, statusCode := s.prepareRequest(method, path, query, requestBody)
+	request.Close = isCloseRequested(protocol, findHeader(headers, connectionHeader))
+	request.AcceptEncoding = findHeader(headers, acceptEncodingHeader)
+	request.IfNoneMatch = findHeader(headers, ifNoneMatchHeader)
+	request.IfMatch = findHeader(headers, ifMatchHeader)
+	request.Origin = findHeader(headers, originHeader)
+
+	return request, statusCode
+}
+
+// acquireBadRequest is for a request line which cannot be parsed, the rest
+// of the connection cannot be trusted either.
+func (s *Server) acquireBadRequest() (*Request, int) {
+	request := s.RequestPool.Get().(*Request)
+	request.Close = true
+
+	return request, 400
+}
+
+func (s *Server) prepareRequest(method []byte, path []byte, query []byte, body []byte) (*Request, int) {
+	request := s.RequestPool.Get().(*Request)
+
+	request.Method = method
+	request.Path = path
+	request.CacheKey = string(path)
+
+	startEntityIdIndex := -1
+	endEntityIdIndex := 0
+
+	for index, char := range request.Path {
+		if startEntityIdIndex == -1 {
+			if char >= 48 && char <= 57 {
+				startEntityIdIndex = index
+			} else {
+				continue
+			}
+		}
+
+		if char >= 48 && char <= 57 {
+			endEntityIdIndex = index
+			continue
+		}
+
+		break
+	}
+
+	if startEntityIdIndex != -1 {
+		request.EntityId, _ = fasthttp.ParseUint(request.Path[startEntityIdIndex : endEntityIdIndex+1])
+
+		//todo performance degradation
+		request.Path = bytes.Replace(request.Path, request.Path[startEntityIdIndex:endEntityIdIndex+1], IdReplacer, -1)
+	}
+
+	if !bytes.Equal(request.Path, GetUserRoute) &&
+		!bytes.Equal(request.Path, GetLocationRoute) &&
+		!bytes.Equal(request.Path, GetVisitRoute) &&
+		!bytes.Equal(request.Path, GetVisitedPlacesRoute) &&
+		!bytes.Equal(request.Path, GetAvgMarkRoute) &&
+		!bytes.Equal(request.Path, CreateUserRoute) &&
+		!bytes.Equal(request.Path, CreateLocationRoute) &&
+		!bytes.Equal(request.Path, CreateVisitRoute) &&
+		!bytes.Equal(request.Path, RestoreUserRoute) &&
+		!bytes.Equal(request.Path, RestoreLocationRoute) &&
+		!bytes.Equal(request.Path, RestoreVisitRoute) &&
+		!bytes.Equal(request.Path, BatchRoute) &&
+		!bytes.Equal(request.Path, TransactionRoute) &&
+		!bytes.Equal(request.Path, TombstonesRoute) &&
+		!bytes.Equal(request.Path, ExportRoute) &&
+		!bytes.Equal(request.Path, ExportUsersRoute) &&
+		!bytes.Equal(request.Path, ExportLocationsRoute) &&
+		!bytes.Equal(request.Path, ExportVisitsRoute) &&
+		!bytes.Equal(request.Path, ExportZipRoute) &&
+		!bytes.Equal(request.Path, ExportOptionsRoute) &&
+		!bytes.Equal(request.Path, ExportUsersCSVRoute) &&
+		!bytes.Equal(request.Path, ExportLocationsCSVRoute) &&
+		!bytes.Equal(request.Path, ExportVisitsCSVRoute) &&
+		!bytes.Equal(request.Path, PurgeTombstonesRoute) {
+		return request, 404
+	}
+
+	if bytes.Equal(request.Method, HeadRequest) {
+		request.Method = GetRequest
+		request.IsHead = true
+	}
+
+	if !isMethodAllowed(routeMethods(request.Path), request.Method) {
+		return request, 405
+	}
+
+	for len(query) != 0 {
+		index := bytes.IndexByte(query, '&')
+
+		if index == -1 {
+			index = len(query)
+		}
+
+		splitIndex := bytes.IndexByte(query[:index], '=')
+
+		if splitIndex == -1 {
+			request.Query[string(query[:index])] = ""
+		} else {
+			request.Query[string(query[:splitIndex])] = string(query[splitIndex+1 : index])
+		}
+
+		if index == len(query) {
+			break
+		}
+
+		query = query[index+1:]
+	}
+
+	if bytes.Equal(request.Method, PostRequest) && !isActionRoute(request.Path) {
+		if len(body) == 0 || body[0] != '{' {
+			return request, 400
+		}
+
+		request.Body = body
+	}
+
+	return request, 200
+}
+
+// routeMethods returns the methods of a whitelisted route, empty for others.
+func routeMethods(path []byte) string {
+	switch {
+	case bytes.Equal(path, GetUserRoute), bytes.Equal(path, GetLocationRoute), bytes.Equal(path, GetVisitRoute):
+		return entityMethods
+	case bytes.Equal(path, GetVisitedPlacesRoute), bytes.Equal(path, GetAvgMarkRoute), bytes.Equal(path, TombstonesRoute):
+		return queryMethods
+	case bytes.HasPrefix(path, ExportRoute):
+		return queryMethods
+	case bytes.Equal(path, CreateUserRoute), bytes.Equal(path, CreateLocationRoute), bytes.Equal(path, CreateVisitRoute), bytes.Equal(path, BatchRoute),
+		bytes.Equal(path, TransactionRoute), isActionRoute(path):
+		return postMethods
+	}
+
+	return ""
+}
+
+// isActionRoute is a POST route which takes no body.
+func isActionRoute(path []byte) bool {
+	return bytes.Equal(path, RestoreUserRoute) ||
+		bytes.Equal(path, RestoreLocationRoute) ||
+		bytes.Equal(path, RestoreVisitRoute) ||
+		bytes.Equal(path, PurgeTombstonesRoute)
+}
+
+// exportFile maps the routes of users_N.json, locations_N.json and
+// visits_N.json to the file they serve, number is the N of the path.
+func exportFile(path []byte, number int) (exporter.File, bool) {
+	switch {
+	case bytes.Equal(path, ExportUsersRoute):
+		return exporter.File{Entity: db.UserEntity, Number: number}, true
+	case bytes.Equal(path, ExportLocationsRoute):
+		return exporter.File{Entity: db.LocationEntity, Number: number}, true
+	case bytes.Equal(path, ExportVisitsRoute):
+		return exporter.File{Entity: db.VisitEntity, Number: number}, true
+	}
+
+	return exporter.File{}, false
+}
+
+func exportCSVEntity(path []byte) string {
+	switch {
+	case bytes.Equal(path, ExportUsersCSVRoute):
+		return db.UserEntity
+	case bytes.Equal(path, ExportLocationsCSVRoute):
+		return db.LocationEntity
+	case bytes.Equal(path, ExportVisitsCSVRoute):
+		return db.VisitEntity
+	}
+
+	return ""
+}
+
+func isMethodAllowed(methods string, method []byte) bool {
+	for len(methods) > 0 {
+		allowed := methods
+		methods = ""
+
+		if index := strings.Index(allowed, ", "); index != -1 {
+			allowed, methods = allowed[:index], allowed[index+2:]
+		}
+
+		if allowed == string(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) releaseRequest(request *Request) {
+	request.Body = nil
+	request.Path = nil
+	request.Method = nil
+	request.EntityId = 0
+	request.CacheKey = ""
+	request.Close = false
+	request.AcceptEncoding = nil
+	request.IfNoneMatch = nil
+	request.IfMatch = nil
+	request.Origin = nil
+	request.IsHead = false
+	for k := range request.Query {
+		delete(request.Query, k)
+	}
+	s.RequestPool.Put(request)
+}
@@ -1,11 +1,12 @@
-package main
+package server
 
 import (
+	"github.com/ArtyomNorin/hlc2017_go/generator"
 	"testing"
 )
 
 func BenchmarkAcquireRequest(b *testing.B) {
-	database, err := InitDatabase("/home/artyomnorin/Projects/hlc2017_go/data/train/data", "/home/artyomnorin/Projects/hlc2017_go/data/train/options.txt")
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
 
 	if err != nil {
 		b.Fatal(err)
@@ -31,7 +32,7 @@ Connection: keep-alive
 }
 
 /*func BenchmarkParseRequest(b *testing.B) {
-	database, err := InitDatabase("/home/artyomnorin/Projects/hlc2017_go/data/train/data", "/home/artyomnorin/Projects/hlc2017_go/data/train/options.txt")
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
 
 	if err != nil {
 		b.Fatal(err)
@@ -55,7 +56,7 @@ Connection: keep-alive
 }*/
 
 func BenchmarkServer_GetFromCache(b *testing.B) {
-	database, err := InitDatabase("/home/artyomnorin/Projects/hlc2017_go/data/train/data", "/home/artyomnorin/Projects/hlc2017_go/data/train/options.txt")
+	database, err := generator.GenerateAndLoad(b.TempDir(), generator.TrainOptions())
 
 	if err != nil {
 		b.Fatal(err)
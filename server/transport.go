@@ -0,0 +1,25 @@
+package server
+
+import (
+	"fmt"
+)
+
+// Transport serves s on port until Shutdown is called. Port 0 picks a free
+// port, the actual address is passed to Server.Serving.
+type Transport interface {
+	Serve(s *Server, port int) error
+	Shutdown() error
+}
+
+func NewTransport(name string) (Transport, error) {
+	switch name {
+	case "evio":
+		return new(EvioTransport), nil
+	case "http":
+		return new(HttpTransport), nil
+	case "fasthttp":
+		return new(FasthttpTransport), nil
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", name)
+}